@@ -0,0 +1,76 @@
+package zipfs
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// A kind of archive that can be opened for serving. Zip is the only
+// one built in; others are added with RegisterBackend.
+type ArchiveBackend interface {
+	// Reports whether the archive called name, which starts with head,
+	// is one this backend reads. head is shorter than HeadLen if the
+	// archive is.
+	Match(name string, head []byte) bool
+	// Reads the archive in r, which is size bytes long.
+	Open(r io.ReaderAt, size int64) (*FS, error)
+}
+
+// How much of the start of an archive is passed to Match
+const HeadLen = 512
+
+// Returned by OpenArchive when no backend recognises the archive
+var ErrUnknownFormat = errors.New("zipfs: not an archive in any known format")
+
+var backends struct {
+	sync.RWMutex
+	list []ArchiveBackend
+}
+
+func init() {
+	RegisterBackend(zipBackend{})
+}
+
+// Adds a backend for OpenArchive to try. Backends are tried starting
+// with the one registered last, so that zip, which takes anything
+// nothing else does, comes after all the others.
+func RegisterBackend(b ArchiveBackend) {
+	backends.Lock()
+	defer backends.Unlock()
+	backends.list = append(backends.list, b)
+}
+
+// Reads the archive in r, which is size bytes long, with the first
+// backend that recognises it. name is only used for matching, by its
+// extension for instance.
+func OpenArchive(name string, r io.ReaderAt, size int64) (*FS, error) {
+	head := make([]byte, min(size, HeadLen))
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	backends.RLock()
+	defer backends.RUnlock()
+	for i := len(backends.list) - 1; i >= 0; i-- {
+		if b := backends.list[i]; b.Match(name, head) {
+			return b.Open(r, size)
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+type zipBackend struct{}
+
+// Anything can be a zip archive: the central directory is at the end,
+// and self-extractors put a program in front of the entries. So it
+// takes whatever no other backend wants, and reports zip.ErrFormat
+// from Open if it's not one after all.
+func (zipBackend) Match(name string, head []byte) bool {
+	return true
+}
+
+func (zipBackend) Open(r io.ReaderAt, size int64) (*FS, error) {
+	return New(r, size)
+}
@@ -0,0 +1,65 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+// A zip archive with a header of its own in front, as a stand-in for
+// some other format.
+type wrappedBackend struct{ opened *int }
+
+const wrappedMagic = "WRAP"
+
+func (wrappedBackend) Match(name string, head []byte) bool {
+	return bytes.HasPrefix(head, []byte(wrappedMagic))
+}
+
+func (b wrappedBackend) Open(r io.ReaderAt, size int64) (*FS, error) {
+	*b.opened++
+	n := int64(len(wrappedMagic))
+	return New(io.NewSectionReader(r, n, size-n), size-n)
+}
+
+func TestOpenArchive(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	fw, err := w.Create("hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+	wrapped := append([]byte(wrappedMagic), plain...)
+
+	var opened int
+	RegisterBackend(wrappedBackend{&opened})
+	defer func() {
+		backends.Lock()
+		backends.list = backends.list[:len(backends.list)-1]
+		backends.Unlock()
+	}()
+	for name, data := range map[string][]byte{"a.zip": plain, "a.wrap": wrapped} {
+		z, err := OpenArchive(name, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := fs.ReadFile(z, "hello.txt")
+		if err != nil || string(got) != "hello" {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+	if opened != 1 {
+		t.Errorf("wrapped backend opened %d archives, want 1", opened)
+	}
+	if _, err := OpenArchive("junk", bytes.NewReader([]byte("junk")), 4); !errors.Is(err, zip.ErrFormat) {
+		t.Errorf("junk: got %v, want zip.ErrFormat", err)
+	}
+}
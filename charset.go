@@ -0,0 +1,54 @@
+package zipfs
+
+import (
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// DetectContentType calls any text without a byte order mark UTF-8,
+// which older archives often aren't. Looks at the sniffed bytes again
+// for a <meta> declaration in HTML, and otherwise takes text that
+// isn't valid UTF-8 to be windows-1252, which is what browsers would
+// guess too. A <meta> declaration wins over what the bytes look like.
+func detectCharset(ctype string, sample []byte) string {
+	mediatype, params, err := mime.ParseMediaType(ctype)
+	if err != nil || !strings.HasPrefix(mediatype, "text/") {
+		return ctype
+	}
+	if cs := params["charset"]; cs != "" && !strings.EqualFold(cs, "utf-8") {
+		// Came from a byte order mark
+		return ctype
+	}
+	valid := validUTF8Prefix(sample)
+	name := "utf-8"
+	if mediatype == "text/html" {
+		// Its last resort is windows-1252, which is only right if the
+		// text isn't UTF-8 anyway
+		_, detected, certain := charset.DetermineEncoding(sample, mediatype)
+		if certain || !valid || detected != "windows-1252" {
+			name = detected
+		}
+	} else if !valid {
+		name = "windows-1252"
+	}
+	params["charset"] = name
+	return mime.FormatMediaType(mediatype, params)
+}
+
+// Whether the sample is UTF-8, allowing for the last character having
+// been cut off.
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		if r, _ := utf8.DecodeLastRune(b); r != utf8.RuneError {
+			return false
+		}
+		b = b[:len(b)-1]
+	}
+	return utf8.Valid(b)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Publishers can put one of these in any directory of the archive to
+// restrict who can see that part of it. It's a list of lines like
+//
+//	# Only the office, and they still need a password
+//	allow 192.0.2.0/24
+//	deny all
+//	require-auth Staff only
+//	user alice $2y$10$...
+//
+// allow and deny take an address, a CIDR prefix, or "all", and the
+// first one matching the client decides. require-auth asks for HTTP
+// basic auth as one of the users in the same file, with bcrypt or
+// {SHA} hashes like in an htpasswd file.
+//
+// A request has to get past every access file between the root of the
+// archive and the entry, so deeper files can only narrow things down.
+const accessFile = ".zipfsaccess"
+
+type accessRules struct {
+	rules []accessRule
+	// Empty unless authentication is required
+	realm string
+	users map[string][]byte
+	// Credentials already checked, to not pay for bcrypt every time
+	verified sync.Map
+}
+
+type accessRule struct {
+	allow  bool
+	prefix netip.Prefix
+	all    bool
+}
+
+func parseAccess(r io.Reader) (*accessRules, error) {
+	a := &accessRules{users: make(map[string][]byte)}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		directive, arg, _ := strings.Cut(strings.TrimSpace(s.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		switch directive {
+		case "", "#":
+		case "allow", "deny":
+			rule := accessRule{allow: directive == "allow"}
+			if arg == "all" {
+				rule.all = true
+			} else if p, err := netip.ParsePrefix(arg); err == nil {
+				rule.prefix = p.Masked()
+			} else if addr, err := netip.ParseAddr(arg); err == nil {
+				rule.prefix = netip.PrefixFrom(addr, addr.BitLen())
+			} else {
+				return nil, fmt.Errorf("bad address %q", arg)
+			}
+			a.rules = append(a.rules, rule)
+		case "require-auth":
+			a.realm = arg
+			if a.realm == "" {
+				a.realm = "zipfs"
+			}
+		case "user":
+			user, hash, ok := strings.Cut(arg, " ")
+			if !ok {
+				return nil, fmt.Errorf("user needs a name and a hash")
+			}
+			a.users[user] = []byte(strings.TrimSpace(hash))
+		default:
+			if !strings.HasPrefix(directive, "#") {
+				return nil, fmt.Errorf("unknown directive %q", directive)
+			}
+		}
+	}
+	return a, s.Err()
+}
+
+// Finds all the access files in the archive, keyed by the directory
+// they're in. One that can't be read denies everything, rather than
+// leaving its directory open.
+func loadAccess(zr *zip.Reader) map[string]*accessRules {
+	access := make(map[string]*accessRules)
+	for _, f := range zr.File {
+		if path.Base(f.Name) != accessFile {
+			continue
+		}
+		dir := path.Dir(f.Name)
+		rules, err := func() (*accessRules, error) {
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return parseAccess(r)
+		}()
+		if err != nil {
+			slog.Error("bad access file, denying everything under it", "name", f.Name, "err", err)
+			rules = &accessRules{rules: []accessRule{{all: true}}}
+		}
+		access[dir] = rules
+	}
+	return access
+}
+
+// Returns 0 if the request may see name (a path in the archive), or
+// else the status to refuse it with.
+func (z *zipFS) CheckAccess(r *http.Request, name string) (int, string) {
+	if status, realm := z.CheckOuterAccess(r); status != 0 {
+		return status, realm
+	}
+	if len(z.access) == 0 {
+		return 0, ""
+	}
+	var dirs []string
+	for dir := name; ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." {
+			break
+		}
+	}
+	ip := ClientIP(r)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		a, ok := z.access[dirs[i]]
+		if !ok {
+			continue
+		}
+		if status, realm := a.Check(r, ip); status != 0 {
+			return status, realm
+		}
+	}
+	return 0, ""
+}
+
+// Checks the request against the rules from outside the archive that
+// cover all of it: -htpasswd, and the access and htpasswd files -config
+// has for it.
+func (z *zipFS) CheckOuterAccess(r *http.Request) (int, string) {
+	for _, a := range []*accessRules{htpasswdRules.Load(), z.settings.access, z.settings.htpasswd} {
+		if a == nil {
+			continue
+		}
+		if status, realm := a.Check(r, ClientIP(r)); status != 0 {
+			return status, realm
+		}
+	}
+	return 0, ""
+}
+
+// Checks the request against one access file, the same way as
+// CheckAccess.
+func (a *accessRules) Check(r *http.Request, ip netip.Addr) (int, string) {
+	if !a.allows(ip) {
+		return http.StatusForbidden, ""
+	}
+	if a.realm != "" {
+		if !a.authenticate(r) {
+			return http.StatusUnauthorized, a.realm
+		}
+		user, _, _ := r.BasicAuth()
+		setPrincipal(r, user)
+	}
+	return 0, ""
+}
+
+// Writes out a refusal and returns false if the request may not see
+// name.
+func (z *zipFS) Authorize(w http.ResponseWriter, r *http.Request, name string) bool {
+	status, realm := z.CheckAccess(r, name)
+	return z.Permit(w, r, status, realm)
+}
+
+// Like permit, with the archive's own page for the status if it has
+// one.
+func (z *zipFS) Permit(w http.ResponseWriter, r *http.Request, status int, realm string) bool {
+	switch status {
+	case 0:
+		return true
+	case http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+		z.Error(w, r, "unauthorized", status)
+	default:
+		z.Error(w, r, "forbidden", status)
+	}
+	return false
+}
+
+// Writes out the refusal CheckAccess decided on, if any, and returns
+// whether the request can go ahead.
+func permit(w http.ResponseWriter, status int, realm string) bool {
+	switch status {
+	case 0:
+		return true
+	case http.StatusUnauthorized:
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+		http.Error(w, "unauthorized", status)
+	default:
+		http.Error(w, "forbidden", status)
+	}
+	return false
+}
+
+func (a *accessRules) allows(ip netip.Addr) bool {
+	for _, rule := range a.rules {
+		if rule.all || rule.prefix.Contains(ip) {
+			return rule.allow
+		}
+	}
+	return true
+}
+
+func (a *accessRules) authenticate(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := a.users[user]
+	if !ok {
+		return false
+	}
+	key := sha256.Sum256([]byte(user + "\x00" + pass))
+	if _, ok := a.verified.Load(key); ok {
+		return true
+	}
+	if !checkPassword(hash, pass) {
+		return false
+	}
+	a.verified.Store(key, true)
+	return true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var accessLog *string = flag.String("access-log", "", "file to append a line to for each request, or - for stdout")
+var accessLogFormat *string = flag.String("access-log-format", "combined", "common, combined, or combined-duration, which adds the time taken in microseconds like Apache's %D")
+var accessLogSample *int = flag.Int("access-log-sample", 1, "log only one in this many paths' successful requests, always the same ones; errors are always logged")
+
+var accessLogOut struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// Opens -access-log, if there is one.
+func OpenAccessLog() {
+	switch *accessLogFormat {
+	case "common", "combined", "combined-duration":
+	default:
+		log.Fatalf("unknown -access-log-format %q", *accessLogFormat)
+	}
+	if *accessLogSample < 1 {
+		log.Fatal("-access-log-sample has to be at least 1")
+	}
+	switch *accessLog {
+	case "":
+	case "-":
+		accessLogOut.w = os.Stdout
+	default:
+		f, err := os.OpenFile(*accessLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		accessLogOut.w = f
+	}
+}
+
+// Logs each request the handler answers in Common or Combined Log
+// Format, for the tools that already read web server logs, followed by
+// the trace ID if the request came with one. The user is whoever
+// logged in through a .zipfsaccess realm, so this has to go inside
+// Meter, and inside Trace for the trace.
+func AccessLog(h http.Handler) http.Handler {
+	if accessLogOut.w == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		cw := &countingWriter{ResponseWriter: w}
+		sw := &statusWriter{ResponseWriter: cw, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		if sw.status < 400 && !sampled(r) {
+			return
+		}
+		user := "-"
+		if p, ok := r.Context().Value(principalKey{}).(*principal); ok {
+			p.Lock()
+			if p.name != "" {
+				user = p.name
+			}
+			p.Unlock()
+		}
+		size := "-"
+		// The server throws away what's written for HEAD
+		if cw.n > 0 && r.Method != http.MethodHead {
+			size = strconv.FormatInt(cw.n, 10)
+		}
+		line := fmt.Sprintf("%s - %s [%s] %s %d %s", ClientIP(r), logField(user),
+			start.Format("02/Jan/2006:15:04:05 -0700"),
+			strconv.Quote(r.Method+" "+r.RequestURI+" "+r.Proto), sw.status, size)
+		if *accessLogFormat != "common" {
+			line += " " + quoteOrDash(r.Referer()) + " " + quoteOrDash(r.UserAgent())
+		}
+		if *accessLogFormat == "combined-duration" {
+			line += " " + strconv.FormatInt(time.Since(start).Microseconds(), 10)
+		}
+		// Last, so the usual fields are where log readers expect them
+		if t, ok := r.Context().Value(traceKey{}).(trace); ok {
+			line += " trace_id=" + t.id
+		}
+		accessLogOut.Lock()
+		io.WriteString(accessLogOut.w, line+"\n")
+		accessLogOut.Unlock()
+	})
+}
+
+// Whether the request's path is one of the ones -access-log-sample
+// logs. Going by a hash of the path, rather than at random, keeps
+// every request for a path that's logged at all.
+func sampled(r *http.Request) bool {
+	if *accessLogSample == 1 {
+		return true
+	}
+	p, _, _ := strings.Cut(r.RequestURI, "?")
+	h := fnv.New32a()
+	io.WriteString(h, p)
+	return h.Sum32()%uint32(*accessLogSample) == 0
+}
+
+// Keeps a field from splitting into several.
+func logField(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func quoteOrDash(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var adminToken *string = flag.String("admin-token", "", "bearer token enabling the /.zipfs/ admin endpoints")
+var maxUpload *int64 = flag.Int64("max-upload", 1<<30, "largest archive in bytes to accept from PUT /.zipfs/archive, or 0 for any size")
+
+// Only lets through requests bearing the -admin-token.
+func RequireAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(*adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zipfs"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Accepts a new zip file as the request body, checks it over, moves it
+// into place on top of the archive, and starts serving it.
+func UploadHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *maxUpload > 0 {
+			if r.ContentLength > *maxUpload {
+				http.Error(w, "archive too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, *maxUpload)
+		}
+		// Write it next to the target so the rename is atomic
+		dir, file := filepath.Split(a.Path)
+		tmp, err := os.CreateTemp(dir, "."+file+".upload-*")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, r.Body)
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if err2 := tmp.Close(); err == nil {
+			err = err2
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "archive too large", http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		z, err := OpenZipFS(tmp.Name(), a.base)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := VerifyCRC(z.File); err != nil {
+			z.Release()
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := a.Deploy(tmp.Name(), z); err != nil {
+			z.Release()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestLog(r).Info("archive replaced", "name", a.Path, "entries", len(z.File))
+		fmt.Fprintf(w, "%d entries\n", len(z.File))
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var alarmErrorRate *float64 = flag.Float64("alarm-error-rate", 0, "fraction of an archive's responses in -alarm-window that can be 404s or server errors before raising an alarm (0 for none)")
+var alarmWindow *time.Duration = flag.Duration("alarm-window", time.Minute, "how long error rates for -alarm-error-rate are measured over")
+var alarmMinRequests *int = flag.Int("alarm-min-requests", 20, "requests an archive needs in a window before its error rate counts")
+var alarmWebhook *string = flag.String("alarm-webhook", "", "URL to POST a JSON description of alarms to as they're raised and cleared")
+
+// Errors counted for an archive over the current window. An alarm
+// stays raised until a whole window goes by under the threshold.
+type alarm struct {
+	mu       sync.Mutex
+	start    time.Time
+	requests int
+	errors   int
+	raised   bool
+}
+
+// What's logged and sent to -alarm-webhook.
+type AlarmEvent struct {
+	Archive  string  `json:"archive"`
+	Prefix   string  `json:"prefix"`
+	State    string  `json:"state"`
+	Requests int     `json:"requests"`
+	Errors   int     `json:"errors"`
+	Rate     float64 `json:"rate"`
+	Window   string  `json:"window"`
+}
+
+func isError(status int) bool {
+	return status == http.StatusNotFound || status >= 500
+}
+
+// Counts a response, returning the state the alarm moved to if it
+// moved.
+func (al *alarm) Record(status int) (state string, requests, errors int) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	now := time.Now()
+	if now.Sub(al.start) >= *alarmWindow {
+		if al.raised && !al.over() {
+			al.raised = false
+			state, requests, errors = "resolved", al.requests, al.errors
+		}
+		al.start, al.requests, al.errors = now, 0, 0
+	}
+	al.requests++
+	if isError(status) {
+		al.errors++
+	}
+	if !al.raised && al.over() {
+		al.raised = true
+		state, requests, errors = "firing", al.requests, al.errors
+	}
+	return state, requests, errors
+}
+
+func (al *alarm) over() bool {
+	return al.requests >= *alarmMinRequests && float64(al.errors) >= *alarmErrorRate*float64(al.requests)
+}
+
+// Keeps track of the archive's error rate as it serves h.
+func (a *Archive) Alarm(h http.Handler) http.Handler {
+	if *alarmErrorRate <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		if state, requests, errors := a.alarm.Record(sw.status); state != "" {
+			ev := AlarmEvent{
+				Archive:  a.Path,
+				Prefix:   a.MountPath(),
+				State:    state,
+				Requests: requests,
+				Errors:   errors,
+				Rate:     float64(errors) / float64(requests),
+				Window:   alarmWindow.String(),
+			}
+			if state == "firing" {
+				slog.Error("error rate alarm", "archive", ev.Archive, "errors", errors, "requests", requests)
+			} else {
+				slog.Info("error rate alarm cleared", "archive", ev.Archive, "errors", errors, "requests", requests)
+			}
+			if *alarmWebhook != "" {
+				go SendAlarm(ev)
+			}
+		}
+	})
+}
+
+// Posts the event to -alarm-webhook. Failures are only logged.
+func SendAlarm(ev AlarmEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("alarm webhook", "err", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *alarmWebhook, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("alarm webhook", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("alarm webhook", "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("alarm webhook", "status", resp.Status)
+	}
+}
+
+// Remembers the status the handler sent.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	// Only the final status, not any 1xx before it
+	if !sw.wrote && status >= 200 {
+		sw.status, sw.wrote = status, true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	sw.wrote = true
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
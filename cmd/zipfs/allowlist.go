@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+// Networks clients may or may not come from. An address has to match
+// none of the deny prefixes and, if there are any allow ones, one of
+// those.
+type netRules struct {
+	allow, deny []netip.Prefix
+}
+
+// From -allow and -deny, for every request.
+var globalNetRules netRules
+
+func init() {
+	flag.Func("allow", "address or CIDR of clients that may connect, any others getting 403 (repeatable)", func(s string) error {
+		p, err := parsePrefix(s)
+		globalNetRules.allow = append(globalNetRules.allow, p)
+		return err
+	})
+	flag.Func("deny", "address or CIDR of clients to refuse with 403, even if -allow takes them in (repeatable)", func(s string) error {
+		p, err := parsePrefix(s)
+		globalNetRules.deny = append(globalNetRules.deny, p)
+		return err
+	})
+}
+
+func parseNetRules(allow, deny []string) (*netRules, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	n := &netRules{}
+	for _, s := range allow {
+		p, err := parsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("allow: %w", err)
+		}
+		n.allow = append(n.allow, p)
+	}
+	for _, s := range deny {
+		p, err := parsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("deny: %w", err)
+		}
+		n.deny = append(n.deny, p)
+	}
+	return n, nil
+}
+
+func (n *netRules) Permits(addr netip.Addr) bool {
+	if n == nil {
+		return true
+	}
+	for _, p := range n.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(n.allow) == 0 {
+		return true
+	}
+	for _, p := range n.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Turns away clients -allow and -deny don't let in, on every route,
+// before anything else is done for them.
+func Restrict(h http.Handler) http.Handler {
+	if len(globalNetRules.allow) == 0 && len(globalNetRules.deny) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := ClientIP(r); !globalNetRules.Permits(ip) {
+			requestLog(r).Debug("refused", "client", ip)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var maxRequests *int = flag.Int("max-requests", 0, "limit on simultaneous requests to an archive")
+
+// The archive currently being served from a path on disk. The
+// underlying zipFS can be swapped out while requests are running;
+// the old one stays open until they finish.
+type Archive struct {
+	Path string
+	base string
+	cur  *zipFS
+	mu   sync.RWMutex
+	// Serializes changes to the files on disk
+	deploy sync.Mutex
+	// Old versions opened on request
+	pinned map[string]*zipFS
+	pinMu  sync.Mutex
+	// One slot per request being served, if limited
+	slots chan struct{}
+	// Where some clients are sent instead, if anywhere
+	canary *Archive
+	// The URL path it's under with -mount
+	mount string
+	// Requests that have found this archive in a ZipServer
+	serving sync.WaitGroup
+	// When the file on disk was last looked at, and whether it's been
+	// changed under us
+	checked     atomic.Int64
+	unavailable atomic.Bool
+	// Errors lately, for -alarm-error-rate
+	alarm alarm
+}
+
+func OpenArchive(name, base string) (*Archive, error) {
+	z, err := OpenZipFS(name, base)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{Path: name, base: base, cur: z, pinned: make(map[string]*zipFS)}
+	if *maxRequests > 0 {
+		a.slots = make(chan struct{}, *maxRequests)
+	}
+	return a, nil
+}
+
+// Turns away requests beyond -max-requests rather than queueing
+// them, so that one busy archive can't tie up the whole server.
+func (a *Archive) Limit(h http.Handler) http.Handler {
+	if a.slots == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case a.slots <- struct{}{}:
+			defer func() { <-a.slots }()
+			h.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests for this archive", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// Returns the current zipFS, which must be released by the caller.
+func (a *Archive) Acquire() *zipFS {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	a.cur.refs.Add(1)
+	return a.cur
+}
+
+// Starts serving from z instead. The previous zip file is closed
+// once the requests still using it are done, and any -purge-url is
+// told about it.
+func (a *Archive) Swap(z *zipFS) {
+	a.mu.Lock()
+	old := a.cur
+	a.cur = z
+	a.mu.Unlock()
+	old.Release()
+	if len(purgeURLs) > 0 {
+		go a.Purge()
+	}
+}
+
+// Lets go of the zip files. Requests still using them keep them open
+// until they finish, but no more should start.
+func (a *Archive) Close() {
+	a.mu.Lock()
+	a.cur.Release()
+	a.mu.Unlock()
+	a.pinMu.Lock()
+	for v, z := range a.pinned {
+		z.Release()
+		delete(a.pinned, v)
+	}
+	a.pinMu.Unlock()
+	if a.canary != nil {
+		a.canary.Close()
+	}
+}
+
+// Picks the zipFS that should handle the request, which must be
+// released by the caller. Returns nil after writing an error.
+func (a *Archive) ForRequest(w http.ResponseWriter, r *http.Request) *zipFS {
+	if !settingsFor(a.Path).network.Permits(ClientIP(r)) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil
+	}
+	if *keepVersions > 0 {
+		w.Header().Add("Vary", versionHeader)
+	}
+	if v := RequestedVersion(r); v != "" && *keepVersions > 0 {
+		z, err := a.Pinned(v)
+		if err != nil {
+			http.Error(w, "no such version", http.StatusNotFound)
+			return nil
+		}
+		w.Header().Set(versionHeader, v)
+		return z
+	}
+	if a.canary != nil && a.UseCanary(w, r) {
+		return a.canary.ForRequest(w, r)
+	}
+	if !a.Refresh() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "archive is being replaced", http.StatusServiceUnavailable)
+		return nil
+	}
+	return a.Acquire()
+}
+
+func (a *Archive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if z := a.ForRequest(w, r); z != nil {
+		defer z.Release()
+		z.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jleedev/zipfs"
+)
+
+// An archive that keeps dated versions of its files in separate
+// directories can list them in this file at the top of the served
+// directory, one per line with the time it's the version as of:
+//
+//	reports/2024-q1   2024-01-01
+//	reports/2024-q2   2024-04-01T00:00:00Z
+//	reports/2024-q3
+//
+// Leaving the time out means the directory's modification time in the
+// archive. A request with ?as-of=TIME then gets the file from the
+// newest of the directories at or before TIME that has it, so a
+// version only needs the files that changed since the one before.
+const asOfFile = ".zipfs.asof"
+
+type datedDir struct {
+	dir string
+	at  time.Time
+}
+
+func parseDatedDirs(r io.Reader, z *zipfs.FS, base string) ([]datedDir, error) {
+	var dirs []datedDir
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		v := datedDir{dir: strings.TrimPrefix(path.Clean("/"+fields[0]), "/")}
+		switch len(fields) {
+		case 1:
+			d, ok := z.Dir(path.Join(base, v.dir))
+			if !ok || d.Modified.IsZero() {
+				return nil, fmt.Errorf("%q: no such directory, or no time for it", v.dir)
+			}
+			v.at = d.Modified
+		case 2:
+			var err error
+			if v.at, err = parseAsOf(fields[1]); err != nil {
+				return nil, fmt.Errorf("%q: %w", s.Text(), err)
+			}
+		default:
+			return nil, fmt.Errorf("%q: want directory and time", s.Text())
+		}
+		dirs = append(dirs, v)
+	}
+	slices.SortStableFunc(dirs, func(a, b datedDir) int { return a.at.Compare(b.at) })
+	return dirs, s.Err()
+}
+
+// Reads the dated directories listed by the archive, oldest first.
+func loadDatedDirs(z *zipfs.FS, base string) []datedDir {
+	name := path.Join(base, asOfFile)
+	f, err := z.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	dirs, err := parseDatedDirs(f, z, base)
+	if err != nil {
+		slog.Error("ignoring bad dated directories", "name", name, "err", err)
+		return nil
+	}
+	return dirs
+}
+
+// Takes RFC 3339, a date on its own, or seconds since 1970.
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%q: want RFC 3339, YYYY-MM-DD, or a Unix time", s)
+}
+
+// Where name was as of t: in the newest dated directory at or before
+// then that has it. False if none does.
+func (z *zipFS) AsOf(name string, t time.Time) (string, bool) {
+	for i := len(z.dated) - 1; i >= 0; i-- {
+		v := z.dated[i]
+		if v.at.After(t) {
+			continue
+		}
+		candidate := path.Join(v.dir, name)
+		if z.Entry(path.Join(z.base, candidate)) != nil {
+			return candidate, true
+		}
+		if _, ok := z.Dir(path.Join(z.base, candidate)); ok {
+			return candidate, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"flag"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+var brotliCache *int64 = flag.Int64("brotli-cache", 0, "bytes of memory for keeping popular files recompressed with brotli, or 0 for none")
+
+// Requests for an entry before it's worth recompressing
+const brotliMinHits = 3
+
+// Memory used by recompressed entries across all open archives
+var brotliBytes atomic.Int64
+
+// Returns the entry recompressed with brotli if that's been done
+// already, counting the request towards doing it otherwise if count is
+// set. The work happens in the background, so this never holds up a
+// response.
+func (z *zipFS) Brotli(f *zip.File, count bool) []byte {
+	if *brotliCache <= 0 || f.UncompressedSize64 > uint64(*brotliCache) {
+		return nil
+	}
+	z.rw.Lock()
+	data, done := z.brotli[f]
+	if done && data != nil {
+		z.brotliUsed[f] = time.Now()
+	}
+	if count {
+		z.brotliHits[f]++
+	}
+	start := count && !done && z.brotliHits[f] == brotliMinHits
+	z.rw.Unlock()
+	if done {
+		return data
+	}
+	if start {
+		z.refs.Add(1)
+		go z.recompress(f)
+	}
+	return nil
+}
+
+// Called with a reference held, which it releases.
+func (z *zipFS) recompress(f *zip.File) {
+	defer z.Release()
+	data, ok := z.CacheLoad("br", f)
+	if !ok {
+		var err error
+		data, err = compressBrotli(f)
+		if err != nil {
+			slog.Warn("brotli", "name", f.Name, "err", err)
+			return
+		}
+		if uint64(len(data)) >= f.CompressedSize64 {
+			// Not worth it, and remembered as such
+			data = []byte{}
+		}
+		z.CacheStore("br", f, data)
+	}
+	if len(data) == 0 {
+		data = nil
+	}
+	z.rw.Lock()
+	defer z.rw.Unlock()
+	if !z.makeBrotliRoom(int64(len(data))) {
+		// It stays on disk for after a restart
+		slog.Debug("brotli cache is full", "name", f.Name)
+		return
+	}
+	z.brotli[f] = data
+	z.brotliSize += int64(len(data))
+	if data != nil {
+		z.brotliUsed[f] = time.Now()
+	}
+	slog.Debug("recompressed", "name", f.Name, "deflate", f.CompressedSize64, "brotli", len(data))
+}
+
+// Takes size bytes of -brotli-cache, dropping this archive's least
+// recently used recompressed entries to make room if need be. Called
+// with z.rw held.
+func (z *zipFS) makeBrotliRoom(size int64) bool {
+	if size > *brotliCache {
+		return false
+	}
+	for brotliBytes.Add(size) > *brotliCache {
+		brotliBytes.Add(-size)
+		var oldest *zip.File
+		for g, t := range z.brotliUsed {
+			if oldest == nil || t.Before(z.brotliUsed[oldest]) {
+				oldest = g
+			}
+		}
+		if oldest == nil {
+			return false
+		}
+		freed := int64(len(z.brotli[oldest]))
+		delete(z.brotli, oldest)
+		delete(z.brotliUsed, oldest)
+		// Needs to get popular again before it's recompressed again
+		delete(z.brotliHits, oldest)
+		z.brotliSize -= freed
+		brotliBytes.Add(-freed)
+	}
+	return true
+}
+
+func compressBrotli(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := io.Copy(bw, r); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+var cacheDir *string = flag.String("cache-dir", "", "directory to keep generated digests and zsync files in across restarts")
+
+// Identifies an archive by what the central directory says is in it,
+// so that anything changing gives it a new key without reading the
+// whole file.
+func archiveHash(zr *zip.Reader) string {
+	h := sha256.New()
+	for _, f := range zr.File {
+		fmt.Fprintf(h, "%q %d %08x %d %d\n", f.Name, f.Method, f.CRC32, f.UncompressedSize64, f.Modified.Unix())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Where the kind of thing generated from f is kept, or from the whole
+// archive if f is nil.
+func (z *zipFS) cachePath(kind string, f *zip.File) string {
+	name := "archive"
+	if f != nil {
+		sum := sha256.Sum256([]byte(f.Name))
+		name = fmt.Sprintf("%08x-%x", f.CRC32, sum[:8])
+	}
+	return filepath.Join(*cacheDir, kind, z.hash[:2], z.hash, name)
+}
+
+// Reads back something stored by CacheStore.
+func (z *zipFS) CacheLoad(kind string, f *zip.File) ([]byte, bool) {
+	if *cacheDir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(z.cachePath(kind, f))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Keeps data for next time. It goes in under a temporary name first so
+// that nobody reads half of it; failing is only worth a warning.
+func (z *zipFS) CacheStore(kind string, f *zip.File, data []byte) {
+	if *cacheDir == "" {
+		return
+	}
+	p := z.cachePath(kind, f)
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err == nil {
+		var tmp *os.File
+		tmp, err = os.CreateTemp(filepath.Dir(p), ".tmp-")
+		if err == nil {
+			_, err = tmp.Write(data)
+			if cerr := tmp.Close(); err == nil {
+				err = cerr
+			}
+			if err == nil {
+				err = os.Rename(tmp.Name(), p)
+			}
+			if err != nil {
+				os.Remove(tmp.Name())
+			}
+		}
+	}
+	if err != nil {
+		slog.Warn("cache", "path", p, "err", err)
+	}
+}
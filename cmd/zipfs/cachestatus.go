@@ -0,0 +1,16 @@
+package main
+
+import "net/http"
+
+// Reports on one of the caches inside zipfs in a Cache-Status header
+// (RFC 9211), to help with working out which layer served what. Each
+// gets its own member: zipfs-archive for open archives with -root,
+// zipfs-lookup for remembered 404s, zipfs-type for content types, and
+// zipfs-body for brotli recompressed bodies.
+func CacheStatus(h http.Header, cache string, hit bool) {
+	if hit {
+		h.Add("Cache-Status", "zipfs-"+cache+"; hit")
+	} else {
+		h.Add("Cache-Status", "zipfs-"+cache+"; fwd=miss")
+	}
+}
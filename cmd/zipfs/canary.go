@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+var canary *string = flag.String("canary", "", "second archive to send some clients to instead, for trying out a new build")
+var canaryPercent *int = flag.Int("canary-percent", 0, "percentage of new clients to send to the -canary archive")
+
+// Remembers which archive a client was given, so they keep getting
+// the same one. Setting it to "canary" or "main" by hand picks one.
+const variantCookie = "zipfs-variant"
+
+const variantMaxAge = 30 * 24 * time.Hour
+
+// Decides whether the request goes to the canary, assigning the client
+// one way or the other the first time they're seen.
+func (a *Archive) UseCanary(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Cookie")
+	variant := ""
+	if c, err := r.Cookie(variantCookie); err == nil && (c.Value == "canary" || c.Value == "main") {
+		variant = c.Value
+	} else {
+		variant = "main"
+		if rand.IntN(100) < *canaryPercent {
+			variant = "canary"
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     variantCookie,
+			Value:    variant,
+			Path:     "/",
+			MaxAge:   int(variantMaxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	w.Header().Set("X-Zipfs-Variant", variant)
+	return variant == "canary"
+}
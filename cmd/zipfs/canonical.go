@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var canonicalURLs = make(map[string]*url.URL)
+
+func init() {
+	flag.Func("canonical", "HOST=SCHEME://CANONICAL-HOST, to redirect requests for HOST that aren't already to that scheme and host there, keeping the path; HOST can be *.example.com or * like with -vhost, and either half of the right side can be left out to keep what the request had, as in *=https:// (repeatable)", func(s string) error {
+		host, target, ok := strings.Cut(s, "=")
+		if !ok || host == "" {
+			return fmt.Errorf("want HOST=SCHEME://CANONICAL-HOST")
+		}
+		u, err := url.Parse(target)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" || u.Scheme == "" && !strings.HasPrefix(target, "//") ||
+			u.Path != "" && u.Path != "/" || u.RawQuery != "" || u.User != nil {
+			return fmt.Errorf("want HOST=SCHEME://CANONICAL-HOST, not %q", target)
+		}
+		host = normalizeHost(host)
+		if _, dup := canonicalURLs[host]; dup {
+			return fmt.Errorf("%s given twice", host)
+		}
+		canonicalURLs[host] = u
+		return nil
+	})
+}
+
+// Whether the request came over TLS, or a -trusted-proxy says it did.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if !trusted(parseHost(r.RemoteAddr)) {
+		return "http"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		p, _, _ = strings.Cut(p, ",")
+		return strings.ToLower(strings.TrimSpace(p))
+	}
+	for _, v := range r.Header.Values("Forwarded") {
+		elem, _, _ := strings.Cut(v, ",")
+		for _, pair := range strings.Split(elem, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(k, "proto") {
+				return strings.ToLower(strings.Trim(v, `"`))
+			}
+		}
+	}
+	return "http"
+}
+
+// Sends requests that aren't for their host's -canonical scheme and
+// host there with a 301, before anything else looks at them.
+func Canonicalize(h http.Handler) http.Handler {
+	if len(canonicalURLs) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want, ok := matchHost(canonicalURLs, r.Host)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		scheme, host := requestScheme(r), r.Host
+		redirect := false
+		if want.Scheme != "" && want.Scheme != scheme {
+			scheme, redirect = want.Scheme, true
+		}
+		if want.Host != "" && normalizeHost(want.Host) != normalizeHost(r.Host) {
+			host, redirect = want.Host, true
+		}
+		if !redirect {
+			h.ServeHTTP(w, r)
+			return
+		}
+		u := url.URL{Scheme: scheme, Host: host}
+		// Not r.RequestURI, which is the whole URL for an absolute-form request
+		http.Redirect(w, r, u.String()+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var realIPHeader *string = flag.String("real-ip-header", "X-Forwarded-For", "header trusted proxies put the client address in: X-Forwarded-For, X-Real-IP, or Forwarded")
+
+var trustedProxies []netip.Prefix
+
+func init() {
+	flag.Func("trusted-proxy", "address or CIDR of a proxy whose -real-ip-header is believed (repeatable)", func(s string) error {
+		p, err := parsePrefix(s)
+		trustedProxies = append(trustedProxies, p)
+		return err
+	})
+}
+
+// Takes a CIDR prefix, or a single address as one that only it's in.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func trusted(addr netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// The address the request came from. If it came through one of the
+// -trusted-proxy addresses, that's whatever the proxy says, going back
+// through the chain of forwarders as long as they're trusted too.
+func ClientIP(r *http.Request) netip.Addr {
+	addr := parseHost(r.RemoteAddr)
+	if !trusted(addr) {
+		return addr
+	}
+	var hops []string
+	switch strings.ToLower(*realIPHeader) {
+	case "x-real-ip":
+		hops = []string{r.Header.Get("X-Real-IP")}
+	case "forwarded":
+		for _, v := range r.Header.Values("Forwarded") {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+					if strings.EqualFold(k, "for") {
+						hops = append(hops, strings.Trim(v, `"`))
+					}
+				}
+			}
+		}
+	default:
+		for _, v := range r.Header.Values(*realIPHeader) {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+	}
+	// The rightmost hop was added by the proxy we trust
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHost(strings.TrimSpace(hops[i]))
+		if !hop.IsValid() {
+			break
+		}
+		addr = hop
+		if !trusted(addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// Accepts 192.0.2.1, 192.0.2.1:80, [2001:db8::1]:80, and 2001:db8::1.
+func parseHost(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, _ := netip.ParseAddr(strings.Trim(s, "[]"))
+	return addr.Unmap()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+var coalesceMinSize *int64 = flag.Int64("coalesce-min-size", 0, "inflate compressed files from this many bytes once for all the clients downloading them at the same time (0 for never)")
+
+// How much inflated data a shared stream keeps for the clients behind
+// the fastest one, give or take as much again. Any that fall further
+// behind go off and inflate the entry for themselves.
+const coalesceWindow = 4 << 20
+
+// An entry being inflated for everyone reading it.
+type sharedInflate struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	// The inflated bytes from base on
+	buf  []byte
+	base int64
+	done bool
+	err  error
+	// Where each reader still attached has got to
+	readers map[*sharedReader]int64
+}
+
+// Returns a reader for the whole of the entry that shares its inflating
+// with anyone else reading it now, or nil if it's not worth it.
+func (z *zipFS) Coalesced(f *zip.File) io.ReadCloser {
+	if *coalesceMinSize <= 0 || f.Method == zip.Store || f.UncompressedSize64 < uint64(*coalesceMinSize) {
+		return nil
+	}
+	z.rw.Lock()
+	defer z.rw.Unlock()
+	if _, ok := z.spool[f]; ok {
+		return nil
+	}
+	s := z.inflating[f]
+	if s != nil {
+		s.mu.Lock()
+		// Too late if the start is gone, or everyone's gone
+		if s.base > 0 || len(s.readers) == 0 {
+			s.mu.Unlock()
+			s = nil
+		}
+	}
+	if s == nil {
+		s = &sharedInflate{readers: make(map[*sharedReader]int64)}
+		s.cond.L = &s.mu
+		z.inflating[f] = s
+		s.mu.Lock()
+		z.refs.Add(1)
+		go z.inflateShared(f, s)
+	}
+	sr := &sharedReader{z: z, f: f, s: s}
+	s.readers[sr] = 0
+	s.mu.Unlock()
+	return sr
+}
+
+// Inflates the entry into s, keeping ahead of the fastest reader by no
+// more than the window. Called with a reference held, which it
+// releases.
+func (z *zipFS) inflateShared(f *zip.File, s *sharedInflate) {
+	defer z.Release()
+	slog.Debug("inflating for all comers", "name", f.Name)
+	defer func() {
+		z.rw.Lock()
+		if z.inflating[f] == s {
+			delete(z.inflating, f)
+		}
+		z.rw.Unlock()
+	}()
+	r, err := f.Open()
+	if err != nil {
+		s.mu.Lock()
+		s.done, s.err = true, err
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		return
+	}
+	defer r.Close()
+	chunk := make([]byte, 64<<10)
+	for {
+		s.mu.Lock()
+		for len(s.readers) > 0 && s.base+int64(len(s.buf))-s.lead() >= coalesceWindow/2 {
+			s.cond.Wait()
+		}
+		if len(s.readers) == 0 {
+			s.done = true
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		n, err := r.Read(chunk)
+
+		s.mu.Lock()
+		s.buf = append(s.buf, chunk[:n]...)
+		// Dropped a window at a time, so it's not copied every chunk
+		if extra := len(s.buf) - coalesceWindow; extra >= coalesceWindow {
+			s.buf = append(s.buf[:0:0], s.buf[extra:]...)
+			s.base += int64(extra)
+		}
+		if err != nil {
+			s.done = true
+			if err != io.EOF {
+				s.err = err
+			}
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Where the fastest reader has got to.
+func (s *sharedInflate) lead() int64 {
+	var lead int64
+	for _, pos := range s.readers {
+		lead = max(lead, pos)
+	}
+	return lead
+}
+
+type sharedReader struct {
+	z   *zipFS
+	f   *zip.File
+	s   *sharedInflate
+	pos int64
+	// Inflating for itself, having fallen behind
+	own io.ReadSeekCloser
+}
+
+func (sr *sharedReader) Read(p []byte) (int, error) {
+	if sr.own != nil {
+		return sr.own.Read(p)
+	}
+	s := sr.s
+	s.mu.Lock()
+	for sr.pos >= s.base+int64(len(s.buf)) && !s.done {
+		s.cond.Wait()
+	}
+	if sr.pos < s.base {
+		sr.detach()
+		s.mu.Unlock()
+		rs, err := sr.z.FS.OpenSeeker(sr.f)
+		if err != nil {
+			return 0, err
+		}
+		sr.own = rs
+		if _, err := rs.Seek(sr.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return rs.Read(p)
+	}
+	defer s.mu.Unlock()
+	if sr.pos == s.base+int64(len(s.buf)) {
+		if s.err != nil {
+			return 0, s.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, s.buf[sr.pos-s.base:])
+	sr.pos += int64(n)
+	s.readers[sr] = sr.pos
+	s.cond.Broadcast()
+	return n, nil
+}
+
+// Stops holding the shared stream back. Called with its lock held.
+func (sr *sharedReader) detach() {
+	delete(sr.s.readers, sr)
+	sr.s.cond.Broadcast()
+}
+
+func (sr *sharedReader) Close() error {
+	if sr.own != nil {
+		return sr.own.Close()
+	}
+	sr.s.mu.Lock()
+	sr.detach()
+	sr.s.mu.Unlock()
+	return nil
+}
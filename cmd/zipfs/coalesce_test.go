@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// An archive with one deflated entry of size bytes, which compresses
+// but not to nothing.
+func coalesceArchive(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	var want bytes.Buffer
+	for i := 0; want.Len() < size; i++ {
+		fmt.Fprintf(&want, "%d %x\n", i, i*i*2654435761)
+	}
+	want.Truncate(size)
+	name := filepath.Join(t.TempDir(), "big.zip")
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(out)
+	fw, err := w.Create("big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(want.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	return name, want.Bytes()
+}
+
+// Readers that keep up, fall behind the window, and give up early all
+// read at once; the ones that finish get the whole entry.
+func TestCoalesced(t *testing.T) {
+	old := *coalesceMinSize
+	*coalesceMinSize = 1
+	defer func() { *coalesceMinSize = old }()
+
+	name, want := coalesceArchive(t, 2*coalesceWindow+1<<20)
+	z, err := OpenZipFS(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Release()
+	f := z.Entry("big.txt")
+	wantSum := sha256.Sum256(want)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rc := z.Coalesced(f)
+			if rc == nil {
+				t.Error("not coalesced")
+				return
+			}
+			defer rc.Close()
+			buf := make([]byte, 32<<10)
+			h := sha256.New()
+			var n int64
+			for {
+				k, err := rc.Read(buf)
+				h.Write(buf[:k])
+				n += int64(k)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				switch {
+				case i%4 == 1 && n < coalesceWindow:
+					time.Sleep(time.Millisecond)
+				case i%4 == 2 && n > coalesceWindow/2:
+					// Gives up partway
+					return
+				}
+			}
+			if got := h.Sum(nil); !bytes.Equal(got, wantSum[:]) || n != int64(len(want)) {
+				t.Errorf("reader %d: got %d bytes, want %d", i, n, len(want))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The shared stream goes away once everyone's done with it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		z.rw.RLock()
+		n := len(z.inflating)
+		z.rw.RUnlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("still inflating")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCoalescedSmall(t *testing.T) {
+	old := *coalesceMinSize
+	*coalesceMinSize = 1 << 20
+	defer func() { *coalesceMinSize = old }()
+
+	name, _ := coalesceArchive(t, 1000)
+	z, err := OpenZipFS(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Release()
+	if rc := z.Coalesced(z.Entry("big.txt")); rc != nil {
+		rc.Close()
+		t.Error("coalesced a file under -coalesce-min-size")
+	}
+}
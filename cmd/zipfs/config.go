@@ -0,0 +1,236 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+var configPath *string = flag.String("config", "", "TOML file whose top level keys are defaults for any flag not given on the command line, and whose [archive.\"NAME\"] tables have settings for one archive, by its path as given or under -root; those are reread when it changes")
+
+// Settings for one archive from -config, which go in place of the
+// flags' for it. The archive's own control files still win.
+type archiveSettings struct {
+	Browse       *bool    `toml:"browse"`
+	Index        string   `toml:"index"`
+	SPA          *bool    `toml:"spa"`
+	Passthrough  *bool    `toml:"passthrough"`
+	CacheControl string   `toml:"cache-control"`
+	EarlyHints   *bool    `toml:"early-hints"`
+	ListingHide  []string `toml:"listing-hide"`
+	// Paths under the served directory to act like aren't there, like
+	// drafts or *.psd, matched against each directory on the way down
+	Exclude []string `toml:"exclude"`
+	// Like -spa-must-exist, on top of those
+	SPAMustExist []string `toml:"spa-must-exist"`
+	// An access file on disk checked before any in the archive
+	Access string `toml:"access"`
+	access *accessRules
+	// An htpasswd file of users to ask for
+	Htpasswd string `toml:"htpasswd"`
+	htpasswd *accessRules
+	// Networks clients have to or can't come from, like -allow and -deny
+	Allow   []string `toml:"allow"`
+	Deny    []string `toml:"deny"`
+	network *netRules
+}
+
+// For archives the config doesn't mention.
+var noSettings = &archiveSettings{}
+
+var config struct {
+	sync.Mutex
+	info     os.FileInfo
+	archives map[string]*archiveSettings
+}
+
+// Reads -config at startup. Flags from the command line take
+// precedence over the file's.
+func LoadConfig() error {
+	if *configPath == "" {
+		return nil
+	}
+	var top map[string]toml.Primitive
+	md, err := toml.DecodeFile(*configPath, &top)
+	if err != nil {
+		return err
+	}
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for key, prim := range top {
+		if key == "archive" || given[key] {
+			continue
+		}
+		if flag.Lookup(key) == nil || key == "config" {
+			return fmt.Errorf("%s: no flag %q", *configPath, key)
+		}
+		var v any
+		if err := md.PrimitiveDecode(prim, &v); err != nil {
+			return err
+		}
+		values, ok := v.([]any)
+		if !ok {
+			values = []any{v}
+		}
+		for _, v := range values {
+			if err := flag.Set(key, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: %s: %w", *configPath, key, err)
+			}
+		}
+	}
+	config.Lock()
+	defer config.Unlock()
+	return readArchiveSettings()
+}
+
+// Rereads the [archive] tables if -config changed, or either way if
+// forced. A file that can't be read any more leaves the settings as
+// they were.
+func reloadConfig(force bool) {
+	if *configPath == "" {
+		return
+	}
+	config.Lock()
+	defer config.Unlock()
+	info, err := os.Stat(*configPath)
+	if err != nil || !force && info.ModTime().Equal(config.info.ModTime()) && info.Size() == config.info.Size() {
+		return
+	}
+	if err := readArchiveSettings(); err != nil {
+		slog.Warn("config changed but can't be reread", "name", *configPath, "err", err)
+		return
+	}
+	slog.Info("config changed, reread", "name", *configPath)
+}
+
+// Called with config held.
+func readArchiveSettings() error {
+	info, err := os.Stat(*configPath)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Archive map[string]*archiveSettings `toml:"archive"`
+	}
+	var top map[string]toml.Primitive
+	md, err := toml.DecodeFile(*configPath, &top)
+	if err != nil {
+		return err
+	}
+	if prim, ok := top["archive"]; ok {
+		if err := md.PrimitiveDecode(prim, &file.Archive); err != nil {
+			return err
+		}
+	}
+	for _, key := range md.Undecoded() {
+		if len(key) > 1 && key[0] == "archive" {
+			return fmt.Errorf("%s: unknown setting %s", *configPath, key)
+		}
+	}
+	for name, s := range file.Archive {
+		if s.network, err = parseNetRules(s.Allow, s.Deny); err != nil {
+			return fmt.Errorf("archive %q: %w", name, err)
+		}
+		if s.Htpasswd != "" {
+			if s.htpasswd, err = loadHtpasswd(s.Htpasswd, *htpasswdRealm); err != nil {
+				return fmt.Errorf("archive %q: %w", name, err)
+			}
+		}
+		if s.Access == "" {
+			continue
+		}
+		f, err := os.Open(s.Access)
+		if err != nil {
+			return fmt.Errorf("archive %q: %w", name, err)
+		}
+		s.access, err = parseAccess(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("archive %q: %s: %w", name, s.Access, err)
+		}
+	}
+	config.info, config.archives = info, file.Archive
+	return nil
+}
+
+// The settings for the archive at name, as opened.
+func settingsFor(name string) *archiveSettings {
+	config.Lock()
+	defer config.Unlock()
+	if s, ok := config.archives[name]; ok {
+		return s
+	}
+	if *root != "" {
+		if rel, err := filepath.Rel(*root, name); err == nil {
+			if s, ok := config.archives[filepath.ToSlash(rel)]; ok {
+				return s
+			}
+		}
+	}
+	return noSettings
+}
+
+// Whether -config has different settings for the archive now.
+func (z *zipFS) settingsChanged() bool {
+	reloadConfig(false)
+	return settingsFor(z.name) != z.settings
+}
+
+func boolSetting(b *bool, flag bool) bool {
+	if b != nil {
+		return *b
+	}
+	return flag
+}
+
+// Whether name, under the served directory, is left out by the
+// archive's exclude setting, either itself or a directory it's in.
+func (z *zipFS) Excluded(name string) bool {
+	return matchPath(z.settings.Exclude, name)
+}
+
+// Whether name, or a directory it's in, matches one of the patterns.
+// Patterns with a slash are matched against the whole path, with or
+// without a leading slash, and others against the base name.
+func matchPath(patterns []string, name string) bool {
+	if len(patterns) == 0 || name == "." {
+		return false
+	}
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && name[i] != '/' {
+			continue
+		}
+		prefix := name[:i]
+		if slices.ContainsFunc(patterns, func(p string) bool {
+			target := prefix
+			if !strings.Contains(p, "/") {
+				target = path.Base(prefix)
+			}
+			ok, _ := path.Match(strings.TrimPrefix(p, "/"), target)
+			return ok
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Excluded for an entry in dir, a directory in the archive.
+func (z *zipFS) excludedIn(dir, name string) bool {
+	if len(z.settings.Exclude) == 0 {
+		return false
+	}
+	rel := path.Join(dir, name)
+	if z.base != "" {
+		rel = strings.TrimPrefix(rel, z.base+"/")
+	}
+	return z.Excluded(rel)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/jleedev/zipfs"
+)
+
+var errorPage *string = flag.String("error-page", "error.html", "page at the top of an archive to send with errors that don't have a page of their own, like 404.html")
+
+// Largest error page that's sent, in case something odd is named that
+// way
+const errorPageMax = 1 << 20
+
+// Sends the archive's page for the status, if it has one and the
+// client may see it: 404.html for a 404 and so on, or else
+// -error-page. Otherwise it's msg as plain text, like http.Error.
+func (z *zipFS) Error(w http.ResponseWriter, r *http.Request, msg string, status int) {
+	for _, name := range []string{fmt.Sprintf("%d.html", status), *errorPage} {
+		if name == "" || z.Excluded(name) {
+			continue
+		}
+		full := path.Join(z.base, name)
+		f := z.Entry(full)
+		if f == nil || f.Mode().IsDir() || f.UncompressedSize64 > errorPageMax || zipfs.Encrypted(f) {
+			continue
+		}
+		if denied, _ := z.CheckAccess(r, full); denied != 0 {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		defer rc.Close()
+		h := w.Header()
+		for _, k := range []string{"ETag", "Last-Modified", "Content-Encoding", "Content-Length", "X-Checksum-CRC32", "Cache-Control"} {
+			h.Del(k)
+		}
+		h.Set("Content-Type", z.GetMime(f))
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			io.Copy(w, rc)
+		}
+		return
+	}
+	http.Error(w, msg, status)
+}
+
+func (z *zipFS) NotFound(w http.ResponseWriter, r *http.Request) {
+	z.Error(w, r, "404 page not found", http.StatusNotFound)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// Whatever packs the archive can attach HTTP metadata to an entry in
+// an extra field with this ID, in the central directory. The data is
+// header lines:
+//
+//	Cache-Control: public, max-age=31536000, immutable
+//	SHA-256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//
+// Cache-Control is sent with the entry. SHA-256, in hex, saves hashing
+// the entry for the manifest and the digest headers.
+const metaExtraID = 0x7a66
+
+// Finds the metadata field among the entry's extra fields.
+func metaExtra(f *zip.File) []byte {
+	extra := f.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return nil
+		}
+		if id == metaExtraID {
+			return extra[4 : 4+size]
+		}
+		extra = extra[4+size:]
+	}
+	return nil
+}
+
+// Reads the metadata fields of every entry, for OpenZipFS.
+func (z *zipFS) loadMetaExtra() {
+	for _, f := range z.File {
+		data := metaExtra(f)
+		if data == nil {
+			continue
+		}
+		// Not appended to data, which shares its array with the
+		// fields after it
+		r := io.MultiReader(bytes.NewReader(data), strings.NewReader("\n\n"))
+		h, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+		if err != nil && len(h) == 0 {
+			continue
+		}
+		if cc := h.Get("Cache-Control"); cc != "" {
+			z.cacheControl[f] = cc
+		}
+		if sum := strings.ToLower(h.Get("SHA-256")); len(sum) == 64 {
+			if _, err := hex.DecodeString(sum); err == nil {
+				z.sha256[f] = sum
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The metadata field going before the AES one mustn't spoil it for
+// decrypting.
+func TestMetaExtraBeforeAES(t *testing.T) {
+	src, err := zip.OpenReader("../../testdata/aes.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	meta := []byte("Cache-Control: max-age=60")
+	field := binary.LittleEndian.AppendUint16(nil, metaExtraID)
+	field = binary.LittleEndian.AppendUint16(field, uint16(len(meta)))
+	field = append(field, meta...)
+
+	name := filepath.Join(t.TempDir(), "meta.zip")
+	out, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(out)
+	for _, f := range src.File {
+		fh := f.FileHeader
+		fh.Extra = append(field[:len(field):len(field)], f.Extra...)
+		fw, err := w.CreateRaw(&fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(fw, r)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	z, err := OpenZipFS(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Release()
+	f := z.Entry("fox.txt")
+	if got := z.cacheControl[f]; got != "max-age=60" {
+		t.Errorf("Cache-Control %q", got)
+	}
+	rc, err := z.Decrypt(f, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "The quick brown fox jumps over the lazy dog.\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "log/slog"
+
+// Set when the archives are opened as they're asked for, to close them
+// all on reloadSignal instead of reopening each one.
+var flushArchives func()
+
+// Rereads -config, -tls-cert, and -htpasswd, and starts over with
+// fresh copies of the archives.
+// Requests already under way finish with the ones they have.
+func Hangup() {
+	slog.Info("reloading")
+	reloadConfig(true)
+	reloadKeyPair()
+	reloadHtpasswd()
+	if flushArchives != nil {
+		flushArchives()
+		return
+	}
+	for _, a := range servedArchives() {
+		a.Reload()
+		a.serving.Done()
+	}
+}
+
+// Lets go of the archives once everything's been served.
+func CloseArchives() {
+	for _, a := range servedArchives() {
+		a.serving.Done()
+		a.Close()
+	}
+}
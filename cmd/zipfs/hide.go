@@ -0,0 +1,50 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"flag"
+	"path"
+	"strings"
+)
+
+var listingHide *string = flag.String("listing-hide", "*.map,*.ts,.*", "comma separated patterns for names to leave out of directory listings unless asked for with ?all")
+
+// An archive can replace -listing-hide with the patterns in this file,
+// one per line, at the top of the served directory. An empty file
+// hides nothing.
+const hideFile = ".zipfs.hide"
+
+func loadHide(zr *zip.Reader, base string, defaults []string) []string {
+	f, err := zr.Open(path.Join(base, hideFile))
+	if err != nil && defaults != nil {
+		return defaults
+	} else if err != nil {
+		var patterns []string
+		for _, p := range strings.Split(*listingHide, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				patterns = append(patterns, p)
+			}
+		}
+		return patterns
+	}
+	defer f.Close()
+	patterns := []string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if p := strings.TrimSpace(s.Text()); p != "" && !strings.HasPrefix(p, "#") {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// Whether the name is left out of listings without ?all.
+func (z *zipFS) Hidden(name string) bool {
+	for _, p := range z.hide {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
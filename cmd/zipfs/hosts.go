@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var allowedHosts []string
+
+func init() {
+	flag.Func("allowed-host", "host name requests have to be for, or *.example.com for any under it, so that a DNS name pointed at the server can't reach it (repeatable; any host if none)", func(s string) error {
+		allowedHosts = append(allowedHosts, normalizeHost(s))
+		return nil
+	})
+}
+
+// Lowercased, and without any port or trailing dot.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func hostAllowed(host string) bool {
+	host = normalizeHost(host)
+	for _, a := range allowedHosts {
+		if a == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(a, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// The value for host in a map of host patterns: the one named exactly,
+// or else the most specific wildcard.
+func matchHost[T any](patterns map[string]T, host string) (T, bool) {
+	host = normalizeHost(host)
+	if v, ok := patterns[host]; ok {
+		return v, true
+	}
+	best, found := "", false
+	for pattern := range patterns {
+		suffix, ok := strings.CutPrefix(pattern, "*")
+		if !ok || !strings.HasSuffix(host, suffix) {
+			continue
+		}
+		if !found || len(pattern) > len(best) {
+			best, found = pattern, true
+		}
+	}
+	return patterns[best], found
+}
+
+// Turns away requests for hosts other than -allowed-host: with a 400
+// if the request line named one, and a 421 if it was the Host header.
+func CheckHost(h http.Handler) http.Handler {
+	if len(allowedHosts) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server takes the host from an absolute-form target over
+		// the Host header
+		if r.URL.IsAbs() && !hostAllowed(r.URL.Host) {
+			http.Error(w, "request for another host", http.StatusBadRequest)
+			return
+		}
+		if !hostAllowed(r.Host) {
+			http.Error(w, "misdirected request", http.StatusMisdirectedRequest)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
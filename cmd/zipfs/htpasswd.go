@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var htpasswdPath *string = flag.String("htpasswd", "", "htpasswd file of users with bcrypt or {SHA} passwords, one of whom every request has to log in as with HTTP basic auth; reread on SIGHUP")
+var htpasswdRealm *string = flag.String("htpasswd-realm", "zipfs", "realm to ask for -htpasswd users in")
+
+var htpasswdRules atomic.Pointer[accessRules]
+
+// Reads an htpasswd file, as made by htpasswd -B or -s, as access rules
+// that ask for one of its users.
+func parseHtpasswd(r io.Reader, realm string) (*accessRules, error) {
+	a := &accessRules{realm: realm, users: make(map[string][]byte)}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want user:hash", n)
+		}
+		if !knownHash(hash) {
+			return nil, fmt.Errorf("line %d: %s's password isn't bcrypt or {SHA}", n, user)
+		}
+		a.users[user] = []byte(hash)
+	}
+	return a, s.Err()
+}
+
+func loadHtpasswd(name, realm string) (*accessRules, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a, err := parseHtpasswd(f, realm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return a, nil
+}
+
+// Reads -htpasswd, if there is one.
+func LoadHtpasswd() error {
+	if *htpasswdPath == "" {
+		return nil
+	}
+	a, err := loadHtpasswd(*htpasswdPath, *htpasswdRealm)
+	if err != nil {
+		return err
+	}
+	htpasswdRules.Store(a)
+	return nil
+}
+
+// Rereads -htpasswd, keeping the users there were if it's no good now.
+func reloadHtpasswd() {
+	if err := LoadHtpasswd(); err != nil {
+		slog.Error("can't reload htpasswd", "name", *htpasswdPath, "err", err)
+	}
+}
+
+func knownHash(hash string) bool {
+	if strings.HasPrefix(hash, "{SHA}") {
+		return true
+	}
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+// Whether pass matches a bcrypt hash, or a base64 SHA-1 one after
+// {SHA}, which htpasswd -s makes.
+func checkPassword(hash []byte, pass string) bool {
+	if b64, ok := strings.CutPrefix(string(hash), "{SHA}"); ok {
+		sum := sha1.Sum([]byte(pass))
+		return subtle.ConstantTimeCompare([]byte(b64), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(pass)) == nil
+}
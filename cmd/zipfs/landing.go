@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var landing *bool = flag.Bool("landing", true, "with -root, list the archives at the top level; a .zipfsaccess in the root directory restricts it")
+var landingTTL *time.Duration = flag.Duration("landing-ttl", 10*time.Second, "how long the landing page reuses the archives it found under -root before looking again")
+
+type LandingEntry struct {
+	Name     string
+	Count    int
+	Size     uint64
+	Modified time.Time
+	path     string
+	// The access file at the top of the archive
+	access *accessRules
+}
+
+type Landing struct {
+	Entries []LandingEntry
+}
+
+// What's known about an archive on disk, for as long as it looks the
+// same.
+type archiveCount struct {
+	size    int64
+	modTime time.Time
+	count   int
+	access  *accessRules
+}
+
+// Finds every archive under the root, walking it again at most once
+// per -landing-ttl. Entry counts come from the central directory, which
+// is only read again if the file changes.
+func (s *ZipServer) Landing() (Landing, error) {
+	s.mu.Lock()
+	if time.Since(s.walked) < *landingTTL {
+		l := s.landing
+		s.mu.Unlock()
+		return l, nil
+	}
+	s.mu.Unlock()
+	var l Landing
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != s.root {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.EqualFold(filepath.Ext(p), ".zip") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.root, p)
+		c := s.count(p, info)
+		l.Entries = append(l.Entries, LandingEntry{
+			Name:     filepath.ToSlash(rel),
+			Count:    c.count,
+			Size:     uint64(info.Size()),
+			Modified: info.ModTime(),
+			path:     p,
+			access:   c.access,
+		})
+		return nil
+	})
+	sort.Slice(l.Entries, func(i, j int) bool { return l.Entries[i].Name < l.Entries[j].Name })
+	if err == nil {
+		s.mu.Lock()
+		s.landing, s.walked = l, time.Now()
+		s.mu.Unlock()
+	}
+	return l, err
+}
+
+// Leaves out the archives the client would be refused.
+func (l Landing) For(r *http.Request) Landing {
+	ip := ClientIP(r)
+	var visible Landing
+	for _, e := range l.Entries {
+		settings := settingsFor(e.path)
+		if !settings.network.Permits(ip) {
+			continue
+		}
+		refused := false
+		for _, a := range []*accessRules{settings.access, settings.htpasswd, e.access} {
+			if a == nil {
+				continue
+			}
+			if status, _ := a.Check(r, ip); status != 0 {
+				refused = true
+				break
+			}
+		}
+		if !refused {
+			visible.Entries = append(visible.Entries, e)
+		}
+	}
+	return visible
+}
+
+func (s *ZipServer) count(name string, info fs.FileInfo) archiveCount {
+	s.mu.Lock()
+	c, ok := s.counts[name]
+	s.mu.Unlock()
+	if ok && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+		return c
+	}
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return archiveCount{}
+	}
+	c = archiveCount{info.Size(), info.ModTime(), len(zr.File), loadAccess(&zr.Reader)["."]}
+	zr.Close()
+	s.mu.Lock()
+	s.counts[name] = c
+	s.mu.Unlock()
+	return c
+}
+
+func (s *ZipServer) ServeLanding(w http.ResponseWriter, r *http.Request) {
+	if a := htpasswdRules.Load(); a != nil {
+		if status, realm := a.Check(r, ClientIP(r)); !permit(w, status, realm) {
+			return
+		}
+	}
+	if f, err := os.Open(filepath.Join(s.root, accessFile)); err == nil {
+		rules, err := parseAccess(f)
+		f.Close()
+		if err != nil {
+			// Same as a bad one inside an archive
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		status, realm := rules.Check(r, ClientIP(r))
+		if !permit(w, status, realm) {
+			return
+		}
+	}
+	l, err := s.Landing()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	l = l.For(r)
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	renderPage(w, r, "landing.html", func(w io.Writer) error {
+		return tmpl.ExecuteTemplate(w, "landing.html", l)
+	}, func(w io.Writer) { plainLanding(w, l) })
+}
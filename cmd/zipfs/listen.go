@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+var unixSocket *string = flag.String("unix", "", "listen on this unix socket instead of -listen, or proxy:PATH for one behind a load balancer that sends a PROXY protocol header on each connection")
+var reusePort *int = flag.Int("reuseport", 1, "number of SO_REUSEPORT sockets to accept on, each with its own accept loop")
+
+// Opens the listening sockets for addr. With more than one, the
+// kernel spreads incoming connections across them.
+func Listen(addr string, n int) ([]net.Listener, error) {
+	if addr, ok := strings.CutPrefix(addr, "proxy:"); ok {
+		lns, err := Listen(addr, n)
+		for i, ln := range lns {
+			lns[i] = ProxyListener{ln}
+		}
+		return lns, err
+	}
+	if n <= 1 {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+	lc := net.ListenConfig{Control: reusePortControl}
+	var lns []net.Listener
+	for range n {
+		ln, err := lc.Listen(context.Background(), "tcp", addr)
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+		// If the port was 0, the rest have to share the one we got
+		addr = ln.Addr().String()
+	}
+	return lns, nil
+}
+
+// Listens on a unix socket, replacing one left behind by an earlier run.
+func ListenUnix(name string) ([]net.Listener, error) {
+	if name, ok := strings.CutPrefix(name, "proxy:"); ok {
+		lns, err := ListenUnix(name)
+		for i, ln := range lns {
+			lns[i] = ProxyListener{ln}
+		}
+		return lns, err
+	}
+	if info, err := os.Lstat(name); err == nil && info.Mode().Type() == fs.ModeSocket {
+		os.Remove(name)
+	}
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: name, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// A process taking over from this one is still using it
+	ln.SetUnlinkOnClose(false)
+	return []net.Listener{ln}, nil
+}
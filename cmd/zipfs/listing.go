@@ -0,0 +1,344 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jleedev/zipfs"
+)
+
+var funcs = template.FuncMap{
+	"bytes":      FormatBytes,
+	"display":    DisplayName,
+	"href":       Href,
+	"suspicious": Suspicious,
+	"row":        func(l Listing, e ListingEntry) ListingRow { return ListingRow{e, l.QR} },
+}
+
+// Everything dir.html gets to work with.
+type Listing struct {
+	Path string
+	// Whether there's anywhere to go up to
+	Parent bool
+	Count  int
+	// Everything inside
+	Size uint64
+	// Only filled in for a dir.html from -template-dir that ranges
+	// over them, instead of having a dir-row for each
+	Entries []ListingEntry
+	QR      bool
+	// Links to sort the listing by each column
+	Sorts []SortLink
+	// Entries left out for -listing-hide, unless All
+	Hidden int
+	All    bool
+	// Link to show or hide them
+	Toggle string
+	rows   iter.Seq[ListingEntry]
+}
+
+type ListingEntry struct {
+	name  string
+	isDir bool
+	// For directories, the number of entries directly inside
+	Count int
+	// For files, and for directories with -dir-sizes, everything inside
+	Size  uint64
+	Sized bool
+	// For directories, the newest thing inside
+	Modified time.Time
+	// For files, the Content-Type
+	Type string
+	// For .zip files, whether they can be browsed like directories
+	Nested bool
+}
+
+func (e ListingEntry) Name() string { return e.name }
+func (e ListingEntry) IsDir() bool  { return e.isDir }
+
+// What dir-row gets.
+type ListingRow struct {
+	ListingEntry
+	QR bool
+}
+
+type SortLink struct {
+	Label string
+	Href  string
+	// Whether the listing is sorted this way, and backwards
+	Current, Desc bool
+}
+
+type sortKey struct {
+	key, label string
+	cmp        func(a, b ListingEntry) int
+}
+
+// The ways a listing can be sorted with ?sort=, the first by default.
+var sortKeys = []sortKey{
+	{"name", "name", func(a, b ListingEntry) int { return strings.Compare(a.Name(), b.Name()) }},
+	{"size", "size", func(a, b ListingEntry) int { return cmp.Compare(a.Size, b.Size) }},
+	{"mtime", "modified", func(a, b ListingEntry) int { return a.Modified.Compare(b.Modified) }},
+}
+
+// Describes the directory dir in the archive, which is being served
+// at urlPath, sorted by the request's ?sort= and ?order=. Sorted by
+// name, the entries come straight from the index one at a time as
+// Rows goes through them, so a huge directory doesn't need them all
+// in memory at once; any other way, they're all made first.
+func (z *zipFS) Listing(dir, urlPath string, query url.Values) Listing {
+	l := Listing{
+		Path:   urlPath,
+		Parent: urlPath != "/",
+		QR:     *qr,
+		All:    query.Has("all"),
+	}
+	d, ok := z.Dir(dir)
+	if !ok {
+		d = &zipfs.DirInfo{}
+	}
+	l.Count, l.Size = d.Count, d.Size
+	for _, name := range d.Names {
+		if !isControlFile(name) && !z.excludedIn(dir, name) && z.Hidden(name) {
+			l.Hidden++
+		}
+	}
+	key, desc := query.Get("sort"), query.Get("order") == "desc"
+	by := slices.IndexFunc(sortKeys, func(k sortKey) bool { return k.key == key })
+	// The index is in name order already
+	byName := by <= 0
+	l.rows = func(yield func(ListingEntry) bool) {
+		for i := range d.Names {
+			name := d.Names[i]
+			if byName && desc {
+				name = d.Names[len(d.Names)-1-i]
+			}
+			if isControlFile(name) || z.excludedIn(dir, name) || !l.All && z.Hidden(name) {
+				continue
+			}
+			if !yield(z.listingEntry(dir, name)) {
+				return
+			}
+		}
+	}
+	if !byName {
+		rows := slices.Collect(l.rows)
+		slices.SortStableFunc(rows, sortKeys[by].cmp)
+		if desc {
+			slices.Reverse(rows)
+		}
+		l.rows = slices.Values(rows)
+	}
+	for i, k := range sortKeys {
+		current := k.key == key || key == "" && i == 0
+		order := "asc"
+		if current && !desc {
+			order = "desc"
+		}
+		v := url.Values{"sort": {k.key}, "order": {order}}
+		if l.All {
+			v.Set("all", "")
+		}
+		l.Sorts = append(l.Sorts, SortLink{
+			Label:   k.label,
+			Href:    "?" + v.Encode(),
+			Current: current,
+			Desc:    current && desc,
+		})
+	}
+	toggle := url.Values{}
+	for _, k := range []string{"sort", "order"} {
+		if v := query.Get(k); v != "" {
+			toggle.Set(k, v)
+		}
+	}
+	if !l.All {
+		toggle.Set("all", "")
+	}
+	l.Toggle = "?" + toggle.Encode()
+	return l
+}
+
+// The entries, in order, made as they're needed.
+func (l Listing) Rows() iter.Seq[ListingEntry] {
+	return l.rows
+}
+
+func (z *zipFS) listingEntry(dir, name string) ListingEntry {
+	le := ListingEntry{name: name}
+	full := path.Join(dir, name)
+	if d, ok := z.Dir(full); ok {
+		le.isDir = true
+		le.Count, le.Modified = d.Count, d.Modified
+		if *dirSizes {
+			le.Size, le.Sized = d.Size, true
+		}
+	} else if f := z.Entry(full); f != nil {
+		le.Size, le.Sized, le.Modified = f.UncompressedSize64, true, f.Modified
+		// Not sniffed, which would mean inflating every file listed
+		le.Type, _ = z.KnownType(f)
+		le.Nested = nestable(f)
+	}
+	return le
+}
+
+// Sends the listing as HTML, a row at a time through dir-row so that
+// only a buffer's worth is held at once. A dir.html from -template-dir
+// without a dir-row gets all the entries at once instead.
+func WriteListing(w io.Writer, r *http.Request, l Listing) {
+	fallback := func(w io.Writer) { plainListing(w, l) }
+	row := tmpl.Lookup("dir-row")
+	if row == nil {
+		renderPage(w, r, "dir.html", func(w io.Writer) error {
+			l.Entries = slices.Collect(l.Rows())
+			return tmpl.ExecuteTemplate(w, "dir.html", l)
+		}, fallback)
+		return
+	}
+	renderPage(w, r, "dir.html", func(w io.Writer) error {
+		if err := tmpl.ExecuteTemplate(w, "dir-head", l); err != nil {
+			return err
+		}
+		for e := range l.Rows() {
+			if err := row.Execute(w, ListingRow{e, l.QR}); err != nil {
+				return err
+			}
+		}
+		return tmpl.ExecuteTemplate(w, "dir-foot", l)
+	}, fallback)
+}
+
+// Human readable sizes, in powers of 1000 like ls --si.
+func FormatBytes(n uint64) string {
+	if n < 1000 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f := float64(n)
+	for _, unit := range []string{"kB", "MB", "GB", "TB"} {
+		f /= 1000
+		if f < 1000 {
+			return fmt.Sprintf("%.1f %s", f, unit)
+		}
+	}
+	return fmt.Sprintf("%.1f PB", f/1000)
+}
+
+// A link to an entry in the same directory. Spaces, #, ?, and % get
+// percent encoded, and a name with a colon in it gets a ./ so it
+// doesn't look like a scheme.
+func Href(name string) string {
+	return (&url.URL{Path: name}).String()
+}
+
+// Entry names come from whoever made the zip file. Markup is taken care
+// of by html/template, but control characters, bidi overrides and
+// invalid UTF-8 are shown as escapes, so that they can't disguise one
+// name as another (like "txt.exe" reversed into "exe.txt").
+func DisplayName(name string) string {
+	var b strings.Builder
+	for len(name) > 0 {
+		r, size := utf8.DecodeRuneInString(name)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, "\\x%02x", name[0])
+		case hiddenRune(r):
+			fmt.Fprintf(&b, "\\u%04x", r)
+		default:
+			b.WriteRune(r)
+		}
+		name = name[size:]
+	}
+	return b.String()
+}
+
+// Whether DisplayName has to escape anything.
+func Suspicious(name string) bool {
+	return !utf8.ValidString(name) || strings.IndexFunc(name, hiddenRune) >= 0
+}
+
+func hiddenRune(r rune) bool {
+	return unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r)
+}
+
+// One entry in a JSON listing.
+type JSONEntry struct {
+	Name string `json:"name"`
+	// Left out for directories without -dir-sizes
+	Size     *uint64   `json:"size,omitempty"`
+	Modified time.Time `json:"modified"`
+	IsDir    bool      `json:"is_dir"`
+	// For directories, the number of entries directly inside
+	Count int    `json:"count,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+// Whether the listing should be JSON instead of HTML, going by
+// ?format=json or an Accept header that asks for JSON and not HTML.
+func WantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// Whether the listing should be plain text, going by ?format=txt, an
+// Accept header that asks for text and not HTML, or a User-Agent like
+// curl's or wget's that doesn't say what it wants.
+func WantsText(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "txt"
+	}
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/html") {
+		return false
+	}
+	if strings.Contains(accept, "text/plain") {
+		return true
+	}
+	ua := r.Header.Get("User-Agent")
+	return (accept == "" || accept == "*/*") &&
+		(strings.HasPrefix(ua, "curl/") || strings.HasPrefix(ua, "Wget/"))
+}
+
+// The listing as plain text, a name to a line with directories ending
+// in a slash. Names are escaped as for display, so that each is one line.
+func TextListing(w io.Writer, l Listing) {
+	for e := range l.Rows() {
+		name := DisplayName(e.Name())
+		if e.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintln(w, name)
+	}
+}
+
+// The listing as JSON.
+func JSONListing(l Listing) []JSONEntry {
+	entries := []JSONEntry{}
+	for e := range l.Rows() {
+		je := JSONEntry{
+			Name:     e.Name(),
+			Modified: e.Modified,
+			IsDir:    e.IsDir(),
+			Count:    e.Count,
+			Type:     e.Type,
+		}
+		if e.Sized {
+			je.Size = &e.Size
+		}
+		entries = append(entries, je)
+	}
+	return entries
+}
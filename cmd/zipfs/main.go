@@ -0,0 +1,676 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jleedev/zipfs"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+//go:embed template/*
+var static embed.FS
+
+var tmpl = template.Must(template.New("").Funcs(funcs).ParseFS(static, "template/*"))
+
+var name *string = flag.String("name", "", "input file path path/to/some/archive.zip")
+var base *string = flag.String("base", "", "base directory in the archive")
+var prefix *string = flag.String("prefix", "", "url prefix to serve under")
+var index *string = flag.String("index", "index.html", "file to serve instead of directory listings")
+var listen *string = flag.String("listen", ":8080", "http listener, or proxy:ADDR for one behind a load balancer that sends a PROXY protocol header on each connection")
+var browse *bool = flag.Bool("browse", true, "serve directory listings")
+var qr *bool = flag.Bool("qr", false, "show QR codes for share links in directory listings")
+var dirSizes *bool = flag.Bool("dir-sizes", false, "show the total size of everything under each subdirectory in listings, not just the one listed")
+var noPassthrough *bool = flag.Bool("no-passthrough", false, "always send files uncompressed instead of as gzip straight from the archive")
+var inMemory *bool = flag.Bool("in-memory", false, "read archives into memory when opening them, instead of keeping the files open")
+var passthroughMinSize *int64 = flag.Int64("passthrough-min-size", 0, "send files smaller than this many bytes uncompressed")
+
+func main() {
+	log.SetFlags(log.Ldate | log.Lmicroseconds | log.Lshortfile)
+	flag.Parse()
+	if err := LoadConfig(); err != nil {
+		log.Fatal(err)
+	}
+	modes := 0
+	for _, set := range []bool{*name != "", *root != "", len(vhosts) > 0, len(mounts) > 0} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(overlays) > 0 && *name == "" {
+		log.Fatal("-overlay only goes with -name")
+	}
+	slog.SetLogLoggerLevel(slog.LevelDebug)
+	if *templateDir != "" {
+		t, err := LoadTemplates(*templateDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tmpl = t
+	}
+	if err := LoadTLS(); err != nil {
+		log.Fatal(err)
+	}
+	if err := LoadHtpasswd(); err != nil {
+		log.Fatal(err)
+	}
+
+	lns, err := InheritedListeners()
+	if err == nil && lns == nil {
+		if *unixSocket != "" {
+			lns, err = ListenUnix(*unixSocket)
+		} else {
+			lns, err = Listen(*listen, *reusePort)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *workers > 0 && os.Getenv(workerEnv) == "" {
+		Supervise(lns, *workers)
+	}
+	OpenAccessLog()
+
+	var site http.Handler
+	if *root != "" {
+		slog.Info("serving archives", "root", *root)
+		s := NewZipServer(*root)
+		servedArchives = s.Archives
+		flushArchives = s.Flush
+		site = s
+	} else if len(vhosts) > 0 {
+		slog.Info("serving virtual hosts", "hosts", len(vhosts))
+		v := NewVirtualHosts()
+		servedArchives = v.Archives
+		flushArchives = v.Flush
+		site = v
+	} else if len(mounts) > 0 {
+		mounts.Open()
+		servedArchives = mounts.Archives
+		site = mounts
+	} else {
+		slog.Info("opening archive", "name", *name)
+		archive, err := OpenArchive(*name, *base)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *canary != "" {
+			slog.Info("opening canary", "name", *canary, "percent", *canaryPercent)
+			archive.canary, err = OpenArchive(*canary, *base)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		servedArchives = func() []*Archive {
+			archive.serving.Add(1)
+			return []*Archive{archive}
+		}
+		site = archive.Limit(archive.Alarm(Throttle(archive)))
+		http.Handle("GET /.zipfs/manifest.json", Meter(archive.Limit(ManifestHandler(archive))))
+		http.Handle("GET /.zipfs/stat/{path...}", Meter(archive.Limit(StatHandler(archive))))
+		http.Handle("GET /.zipfs/archive.zip", archive.Limit(RawArchiveHandler(archive)))
+		http.Handle("GET /.zipfs/archive.zip.zsync", archive.Limit(ArchiveZsyncHandler(archive)))
+		if *adminToken != "" {
+			http.Handle("PUT /.zipfs/archive", RequireAdmin(UploadHandler(archive)))
+			http.Handle("OPTIONS /.zipfs/archive", Options("PUT"))
+			http.Handle("GET /.zipfs/versions", RequireAdmin(VersionsHandler(archive)))
+			http.Handle("POST /.zipfs/promote", RequireAdmin(PromoteHandler(archive)))
+			http.Handle("OPTIONS /.zipfs/promote", Options("POST"))
+			http.Handle("POST /.zipfs/rollback", RequireAdmin(RollbackHandler(archive)))
+			http.Handle("OPTIONS /.zipfs/rollback", Options("POST"))
+		}
+	}
+	// GET also covers HEAD, and the mux answers anything else with a 405
+	http.Handle("GET /", Instrument(Trace(Meter(AccessLog(Canonicalize(Timeout(Normalize(http.StripPrefix(*prefix, site)), *timeout)))))))
+	http.Handle("OPTIONS /", Options("GET, HEAD"))
+	if *adminToken != "" {
+		http.Handle("GET /.zipfs/usage", RequireAdmin(UsageHandler()))
+	}
+	if *metricsAddr != "" {
+		ServeMetrics(*metricsAddr)
+	}
+
+	Serve(lns)
+}
+
+// Wrapper around the zip file which provides HTTP serving with
+// precompressed gzip encoding.
+type zipFS struct {
+	*zipfs.FS
+	// The archive itself, for raw access. The file is nil if it's
+	// been read into memory.
+	name    string
+	file    *os.File
+	raw     io.ReaderAt
+	info    os.FileInfo
+	modTime time.Time
+	base    string
+	// The -overlay archives on top of it
+	layers []layer
+	// From -config
+	settings *archiveSettings
+	// Key for the disk cache, if there is one
+	hash string
+	// The archive asked not to have its directories listed
+	noListing bool
+	// The archive asked for its files to be sent uncompressed
+	noPassthrough bool
+	// The archive asked for -spa
+	spa bool
+	// Names left out of listings
+	hide []string
+	// Dated directories for ?as-of, oldest first
+	dated []datedDir
+	// Access files by directory
+	access   map[string]*accessRules
+	rewrites []rewriteRule
+	// From the entries' metadata extra fields
+	cacheControl map[*zip.File]string
+	sha256       map[*zip.File]string
+	zsync        map[*zip.File][]byte
+	preload      map[*zip.File][]string
+	notFound     map[string]time.Time
+	// Entries recompressed with brotli, nil if it didn't help
+	brotli     map[*zip.File][]byte
+	brotliHits map[*zip.File]int
+	brotliSize int64
+	// Shared inflating for -coalesce-min-size
+	inflating map[*zip.File]*sharedInflate
+	// Large entries extracted to -spool-dir
+	spool     map[*zip.File]string
+	spoolHits map[*zip.File]int
+	// Archives inside this one, opened for browsing
+	nested map[*zip.File]*zipFS
+	rw     sync.RWMutex
+	// Held by the owning Archive and by each in-flight request,
+	// the zip file is closed when it drops to zero.
+	refs atomic.Int64
+	// For -readahead, and where each client is reading
+	order   *readOrder
+	reading map[string]readPosition
+	// When each inflated nested archive was last used
+	nestedUsed map[*zip.File]time.Time
+	// Memory held in zsync, for -zsync-cache
+	zsyncSize int64
+	// When each file in spool was last read, for -spool-max
+	spoolUsed map[*zip.File]time.Time
+	// When each entry in brotli was last sent, for -brotli-cache
+	brotliUsed map[*zip.File]time.Time
+}
+
+// Opens the archive at name for serving its base directory.
+func OpenZipFS(name, base string) (*zipFS, error) {
+	// Named the way fs.FS and the zip entries would have it
+	base = strings.Trim(path.Clean("/"+base), "/")
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var raw io.ReaderAt = f
+	if *inMemory {
+		data := make([]byte, info.Size())
+		_, err = io.ReadFull(f, data)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		f, raw = nil, bytes.NewReader(data)
+	}
+	zfs, err := zipfs.OpenArchive(name, raw, info.Size())
+	if *partial && errors.Is(err, zip.ErrFormat) {
+		zfs, err = OpenPartial(name, raw, info)
+	}
+	if err == nil && *verifyOnOpen {
+		err = VerifyArchive(zfs.Reader, info.Size())
+	}
+	var layers []layer
+	var baseFiles []*zip.File
+	if err == nil && len(overlays) > 0 {
+		baseFiles = zfs.File
+		zfs, layers, err = openOverlays(zfs)
+	}
+	if err == nil {
+		if _, ok := zfs.Dir(base); base != "" && !ok {
+			closeLayers(layers)
+			err = fmt.Errorf("no directory %q to serve", base)
+		}
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	z := newZipFS(name, f, raw, info, zfs, base)
+	z.layers = layers
+	if z.order != nil && len(layers) > 0 {
+		// The layers' files are in other files than z.file
+		z.order = newReadOrder(z, baseFiles)
+	}
+	for _, l := range layers {
+		if l.info.ModTime().After(z.modTime) {
+			z.modTime = l.info.ModTime()
+		}
+	}
+	return z, nil
+}
+
+// Sets up serving for an archive that's been read, which f, if not
+// nil, is closed along with.
+func newZipFS(name string, f *os.File, raw io.ReaderAt, info os.FileInfo, zfs *zipfs.FS, base string) *zipFS {
+	zr := zfs.Reader
+	settings := settingsFor(name)
+	z := &zipFS{
+		FS:           zfs,
+		name:         name,
+		file:         f,
+		raw:          raw,
+		info:         info,
+		modTime:      info.ModTime(),
+		access:       loadAccess(zr),
+		rewrites:     loadRewrites(zr, base),
+		hide:         loadHide(zr, base, settings.ListingHide),
+		dated:        loadDatedDirs(zfs, base),
+		base:         base,
+		settings:     settings,
+		cacheControl: make(map[*zip.File]string),
+		sha256:       make(map[*zip.File]string),
+		zsync:        make(map[*zip.File][]byte),
+		preload:      make(map[*zip.File][]string),
+		notFound:     make(map[string]time.Time),
+		brotli:       make(map[*zip.File][]byte),
+		brotliHits:   make(map[*zip.File]int),
+		inflating:    make(map[*zip.File]*sharedInflate),
+		spool:        make(map[*zip.File]string),
+		spoolHits:    make(map[*zip.File]int),
+		nested:       make(map[*zip.File]*zipFS),
+		nestedUsed:   make(map[*zip.File]time.Time),
+		spoolUsed:    make(map[*zip.File]time.Time),
+		brotliUsed:   make(map[*zip.File]time.Time),
+	}
+	z.loadMetaExtra()
+	for f, ctype := range loadMimeTypes(zr, base) {
+		z.SetMime(f, ctype)
+	}
+	if *cacheDir != "" {
+		z.hash = archiveHash(zr)
+	}
+	if *readahead > 0 {
+		z.order = newReadOrder(z, zr.File)
+		z.reading = make(map[string]readPosition)
+	}
+	if _, err := fs.Stat(zr, path.Join(base, ".nolisting")); err == nil {
+		z.noListing = true
+	}
+	if _, err := fs.Stat(zr, path.Join(base, ".spa")); err == nil {
+		z.spa = true
+	}
+	if _, err := fs.Stat(zr, path.Join(base, ".nopassthrough")); err == nil {
+		z.noPassthrough = true
+	}
+	z.refs.Store(1)
+	if *sniffOnOpen {
+		z.refs.Add(1)
+		go z.PrecomputeMime()
+	}
+	return z
+}
+
+func (z *zipFS) Release() {
+	if z.refs.Add(-1) == 0 {
+		slog.Debug("closing archive", "name", z.name)
+		if z.file != nil {
+			z.file.Close()
+		}
+		closeLayers(z.layers)
+		brotliBytes.Add(-z.brotliSize)
+		zsyncBytes.Add(-z.zsyncSize)
+		z.removeSpool()
+		for f := range z.nested {
+			z.dropNested(f)
+		}
+	}
+}
+
+// Finds the named file under the base directory.
+func (z *zipFS) Find(name string) (*zipfs.ZipEntry, error) {
+	return z.FS.Find(path.Join(z.base, name))
+}
+
+func (z *zipFS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The URL always starts with a /, but z.Open doesn't want that
+	// It ends with a / if it's a directory, but z.Open doesn't want that either
+	requestLog(r).Debug("serving", "url", r.URL, "client", ClientIP(r))
+	if r = z.Rewrite(w, r); r == nil {
+		return
+	}
+	name := strings.Trim(r.URL.Path, "/")
+	if name == "" {
+		name = "."
+	}
+	if isControlFile(name) || z.Excluded(name) {
+		z.NotFound(w, r)
+		return
+	}
+	if asOf := r.URL.Query().Get("as-of"); asOf != "" && len(z.dated) > 0 {
+		t, err := parseAsOf(asOf)
+		if err != nil {
+			z.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resolved, ok := z.AsOf(name, t)
+		if !ok {
+			z.NotFound(w, r)
+			return
+		}
+		name = resolved
+	}
+	if !z.Authorize(w, r, path.Join(z.base, name)) {
+		return
+	}
+	if f, rest, ok := z.NestedPath(name, strings.HasSuffix(r.URL.Path, "/")); ok {
+		z.ServeNested(w, r, f, rest)
+		return
+	}
+	var entry *zipfs.ZipEntry
+	var err error
+	if z.KnownMissing(name) {
+		CacheStatus(w.Header(), "lookup", true)
+		err = fs.ErrNotExist
+	} else if entry, err = z.Find(name); err != nil {
+		CacheStatus(w.Header(), "lookup", false)
+		// Not a failure to read it, which might not happen next time
+		if errors.Is(err, fs.ErrNotExist) {
+			z.Missing(name)
+		}
+	}
+	if err != nil {
+		if status, ok := z.Fallback(name); ok {
+			if status == http.StatusNotFound {
+				w = &softNotFound{ResponseWriter: w}
+				// A 304 or a 206 would hide it
+				r = r.Clone(r.Context())
+				for _, k := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+					r.Header.Del(k)
+				}
+			}
+			name = cmp.Or(z.settings.Index, *index)
+			entry, err = z.Find(name)
+		}
+	}
+	if err != nil {
+		z.NotFound(w, r)
+		return
+	}
+	defer entry.Close()
+
+	if *qr && r.URL.Query().Has("qr") {
+		ServeQR(w, r)
+		return
+	}
+
+	if entry.Entry != nil && zipfs.Encrypted(entry.Entry) {
+		z.ServeEncrypted(w, r, entry.Entry)
+		return
+	}
+
+	if r.URL.Query().Has("zsync") && entry.Entry != nil && !entry.Entry.Mode().IsDir() {
+		ServeZsync(w, z, entry.Entry)
+		return
+	}
+
+	if entry.Entry != nil {
+		w.Header().Set("Last-Modified", entry.Entry.Modified.UTC().Format(http.TimeFormat))
+	} else if dir := path.Join(z.base, name); dir == "." {
+		w.Header().Set("Last-Modified", z.modTime.UTC().Format(http.TimeFormat))
+	} else if d, ok := z.Dir(dir); ok && !d.Modified.IsZero() {
+		// A directory that only exists implicitly
+		w.Header().Set("Last-Modified", d.Modified.UTC().Format(http.TimeFormat))
+	}
+	if entry.Entry != nil && !entry.Entry.Mode().IsDir() {
+		w.Header().Set("ETag", FileETag(entry.Entry))
+	} else if d, ok := z.Dir(path.Join(z.base, name)); ok {
+		w.Header().Set("ETag", DirETag(d))
+	}
+
+	// If index.html handling is enabled:
+	// - When reading a directory, see if you want to read index.html instead
+	// - When reading index.html, redirect to the directory
+
+	if _, ok := entry.File.(fs.ReadDirFile); ok {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// Redirect to what the client asked for, still encoded the same
+			// way and with any prefix still on it
+			u, err := url.ParseRequestURI(r.RequestURI)
+			if err != nil {
+				z.Error(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			u.Path, u.RawPath = u.Path+"/", u.EscapedPath()+"/"
+			http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+		if !boolSetting(z.settings.Browse, *browse) || z.noListing {
+			z.Error(w, r, "directory listing is disabled", http.StatusForbidden)
+			return
+		}
+		w.Header().Add("Vary", "Accept, User-Agent")
+		if NotModified(w, r) {
+			return
+		}
+		// Serve the directory listing
+		dir := path.Join(z.base, name)
+		listing := z.Listing(dir, r.URL.Path, r.URL.Query())
+		if WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(JSONListing(listing))
+			return
+		}
+		if WantsText(r) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			TextListing(w, listing)
+			return
+		}
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		WriteListing(w, r, listing)
+	} else {
+		if entry.Entry == nil {
+			panic("impossible")
+		}
+		z.ReadAhead(r, entry.Entry)
+		CacheStatus(w.Header(), "type", z.HasMime(entry.Entry))
+		ctype, ok := z.KnownType(entry.Entry)
+		if !ok && r.Method == http.MethodHead {
+			// Sniffing it would mean inflating it
+			ctype = "application/octet-stream"
+		} else if !ok {
+			ctype = z.GetMime(entry.Entry)
+		}
+		w.Header().Set("Content-Type", ctype)
+		if cc, ok := z.cacheControl[entry.Entry]; ok {
+			w.Header().Set("Cache-Control", cc)
+		} else if cc := z.settings.CacheControl; cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		if *preload && strings.HasPrefix(ctype, "text/html") {
+			links := z.PreloadLinks(entry.Entry, r.Method != http.MethodHead)
+			for _, link := range links {
+				w.Header().Add("Link", link)
+			}
+			// 1xx responses don't exist in HTTP/1.0
+			if boolSetting(z.settings.EarlyHints, *earlyHints) && len(links) > 0 && r.ProtoAtLeast(1, 1) {
+				w.WriteHeader(http.StatusEarlyHints)
+			}
+		}
+		w.Header().Set("X-Checksum-CRC32", fmt.Sprintf("%08x", entry.Entry.CRC32))
+		// The same file might be in the archive compressed another way
+		f := z.Variant(r, entry.Entry)
+		passthrough := z.Passthrough(f)
+		precompressed := z.Siblings(name)
+		if passthrough || precompressed != nil || z.Variants(entry.Entry) != nil {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		if NotModified(w, r) {
+			return
+		}
+		// Ranges are of the uncompressed file
+		if r.Header.Get("Range") != "" {
+			passthrough, precompressed = false, nil
+		}
+		if precompressed != nil && z.ServeSibling(w, r, precompressed) {
+			return
+		}
+		if passthrough && f.Method == zipfs.Zstd && zipfs.AcceptsEncoding(r, "zstd") {
+			// A zstd entry is a zstd frame already
+			w.Header().Set("Content-Encoding", "zstd")
+			w.Header().Set("Content-Length", strconv.FormatUint(f.CompressedSize64, 10))
+			if r.Method == http.MethodHead {
+				return
+			}
+			src, err := f.OpenRaw()
+			if err != nil {
+				z.Error(w, r, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			io.Copy(w, src)
+			return
+		}
+		if passthrough && zipfs.AcceptsEncoding(r, "br") {
+			data := z.Brotli(f, r.Method != http.MethodHead)
+			if *brotliCache > 0 {
+				CacheStatus(w.Header(), "body", data != nil)
+			}
+			if data != nil {
+				w.Header().Set("Content-Encoding", "br")
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				w.Write(data)
+				return
+			}
+		}
+		if passthrough && f.Method == zip.Deflate && zipfs.AcceptsEncoding(r, "gzip") {
+			// The entry is compressed and we're ready to serve up some gzip
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("Content-Length", strconv.FormatUint(zipfs.GzipSize(f), 10))
+			if r.Method == http.MethodHead {
+				return
+			}
+
+			w.Write(zipfs.GzipHeader(f))
+			src, err := f.OpenRaw()
+			if err != nil {
+				z.Error(w, r, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if *verifyPassthrough {
+				if err := CopyVerified(w, src, f); err != nil {
+					// Leave the client with a broken gzip stream
+					requestLog(r).Error("passthrough", "name", f.Name, "err", err)
+					panic(http.ErrAbortHandler)
+				}
+			} else {
+				io.Copy(w, src)
+			}
+
+			w.Write(zipfs.GzipTrailer(f))
+		} else {
+			// Just serve a plain response
+			if sum, ok := z.CachedSHA256(entry.Entry); ok {
+				SetDigest(w.Header(), sum)
+			}
+			if r.Method != http.MethodHead && r.Header.Get("Range") == "" {
+				if cr := z.Coalesced(entry.Entry); cr != nil {
+					defer cr.Close()
+					w.Header().Set("Accept-Ranges", "bytes")
+					w.Header().Set("Content-Length", strconv.FormatUint(entry.Entry.UncompressedSize64, 10))
+					io.Copy(w, cr)
+					return
+				}
+			}
+			rs, err := z.OpenSeeker(entry.Entry)
+			if err != nil {
+				z.Error(w, r, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer rs.Close()
+			http.ServeContent(w, r, "", entry.Entry.Modified, rs)
+		}
+	}
+}
+
+// Whether the entry can be sent as gzip, or zstd, straight out of the
+// archive. Small files aren't worth the gzip framing or the Vary header,
+// and encrypted ones would go out still encrypted.
+func (z *zipFS) Passthrough(f *zip.File) bool {
+	return (f.Method == zip.Deflate || f.Method == zipfs.Zstd) && boolSetting(z.settings.Passthrough, !*noPassthrough) && !z.noPassthrough &&
+		f.UncompressedSize64 >= uint64(*passthroughMinSize) && !zipfs.Encrypted(f)
+}
+
+// Answers OPTIONS for a route that takes methods.
+func Options(methods string) http.Handler {
+	allow := methods + ", OPTIONS"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Serves a PNG QR code encoding the absolute URL of the request,
+// minus the query string, so it can be scanned from a phone.
+// RequestURI is used since StripPrefix has already rewritten URL.Path.
+func ServeQR(w http.ResponseWriter, r *http.Request) {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	u.RawQuery = ""
+	u.Host = r.Host
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	png, err := qrcode.Encode(u.String(), qrcode.Medium, 256)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+func (z *zipFS) GetMime(f *zip.File) string {
+	ctype, err := z.MimeType(f)
+	if err != nil {
+		panic(err)
+	}
+	return ctype
+}
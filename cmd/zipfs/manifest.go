@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jleedev/zipfs"
+)
+
+var manifestSHA256 *bool = flag.Bool("manifest-sha256", false, "include SHA-256 digests in /.zipfs/manifest.json")
+
+type ManifestEntry struct {
+	Name     string    `json:"name"`
+	Size     uint64    `json:"size"`
+	Modified time.Time `json:"modified"`
+	CRC32    string    `json:"crc32"`
+	SHA256   string    `json:"sha256,omitempty"`
+}
+
+// Lists every file under the base directory that the request is
+// allowed to see, so that mirrors can tell what changed without
+// downloading anything.
+func (z *zipFS) Manifest(r *http.Request) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	for _, f := range z.File {
+		// Other copies of a file are the same file
+		if isControlFile(f.Name) || z.Entry(f.Name) != f {
+			continue
+		}
+		if status, _ := z.CheckAccess(r, f.Name); status != 0 {
+			continue
+		}
+		name := f.Name
+		if z.base != "" {
+			var ok bool
+			name, ok = strings.CutPrefix(name, z.base+"/")
+			if !ok {
+				continue
+			}
+		}
+		if strings.HasSuffix(name, "/") || name == "" || z.Excluded(name) {
+			continue
+		}
+		e := ManifestEntry{
+			Name:     name,
+			Size:     f.UncompressedSize64,
+			Modified: f.Modified,
+			CRC32:    fmt.Sprintf("%08x", f.CRC32),
+		}
+		if *manifestSHA256 && !zipfs.Encrypted(f) {
+			var err error
+			e.SHA256, err = z.SHA256(f)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Hashes the uncompressed contents of the entry, the first time
+// anybody asks for it.
+func (z *zipFS) SHA256(f *zip.File) (string, error) {
+	if sum, ok := z.CachedSHA256(f); ok {
+		return sum, nil
+	}
+	if data, ok := z.CacheLoad("sha256", f); ok {
+		sum := string(data)
+		z.rw.Lock()
+		z.sha256[f] = sum
+		z.rw.Unlock()
+		return sum, nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	z.CacheStore("sha256", f, []byte(sum))
+	z.rw.Lock()
+	z.sha256[f] = sum
+	z.rw.Unlock()
+	return sum, nil
+}
+
+// Returns the SHA-256 digest if it's been computed already.
+func (z *zipFS) CachedSHA256(f *zip.File) (string, bool) {
+	z.rw.RLock()
+	defer z.rw.RUnlock()
+	sum, ok := z.sha256[f]
+	return sum, ok
+}
+
+// Sets both the current and the older digest header from a hex
+// SHA-256. These describe the bytes as sent, so they only go on
+// responses without a Content-Encoding.
+func SetDigest(h http.Header, sum string) {
+	raw, err := hex.DecodeString(sum)
+	if err != nil {
+		return
+	}
+	b64 := base64.StdEncoding.EncodeToString(raw)
+	h.Set("Repr-Digest", "sha-256=:"+b64+":")
+	h.Set("Digest", "SHA-256="+b64)
+}
+
+func ManifestHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		z := a.ForRequest(w, r)
+		if z == nil {
+			return
+		}
+		defer z.Release()
+		entries, err := z.Manifest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var metricsAddr *string = flag.String("metrics", "", "address to serve Prometheus metrics on at /metrics, such as localhost:9100")
+
+// Upper bounds of the latency histogram, in seconds
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var metrics = struct {
+	sync.Mutex
+	// By status
+	requests map[int]int64
+	// By Content-Encoding, so identity is sent as it is or inflated,
+	// gzip is passthrough, and br is recompressed
+	bytes map[string]int64
+	// Counts per bucket, the last for anything slower
+	latency      []int64
+	latencySum   float64
+	latencyCount int64
+}{
+	requests: make(map[int]int64),
+	bytes:    make(map[string]int64),
+	latency:  make([]int64, len(latencyBuckets)+1),
+}
+
+// With -root, whether requests found their archive open already
+var archiveHits, archiveMisses atomic.Int64
+
+// The archives being served, set once they're open. The caller has
+// to call Done on each one's serving.
+var servedArchives func() []*Archive
+
+// Counts the handler's responses towards the metrics.
+func Instrument(h http.Handler) http.Handler {
+	if *metricsAddr == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		cw := &countingWriter{ResponseWriter: w}
+		sw := &statusWriter{ResponseWriter: cw, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		elapsed := time.Since(start).Seconds()
+		coding := w.Header().Get("Content-Encoding")
+		if coding == "" {
+			coding = "identity"
+		}
+		i, _ := slices.BinarySearch(latencyBuckets, elapsed)
+		metrics.Lock()
+		metrics.requests[sw.status]++
+		metrics.bytes[coding] += cw.n
+		metrics.latency[i]++
+		metrics.latencySum += elapsed
+		metrics.latencyCount++
+		metrics.Unlock()
+	})
+}
+
+// Listens on -metrics in the background. It's not fatal if that
+// doesn't work, since that's what happens to every worker but the
+// first, and to a process taking over from another.
+func ServeMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", MetricsHandler)
+	go func() {
+		slog.Error("metrics listener", "err", http.ListenAndServe(addr, mux))
+	}()
+}
+
+// Writes the metrics in the Prometheus text format.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	var archives []*Archive
+	if servedArchives != nil {
+		archives = servedArchives()
+	}
+	mimeCached := 0
+	for _, a := range archives {
+		z := a.Acquire()
+		mimeCached += z.MimeCached()
+		z.Release()
+		a.serving.Done()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Lock()
+	defer metrics.Unlock()
+	fmt.Fprintf(w, "# HELP zipfs_requests_total Requests answered, by status.\n# TYPE zipfs_requests_total counter\n")
+	codes := make([]int, 0, len(metrics.requests))
+	for code := range metrics.requests {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "zipfs_requests_total{code=\"%d\"} %d\n", code, metrics.requests[code])
+	}
+	fmt.Fprintf(w, "# HELP zipfs_response_bytes_total Bytes of response bodies, by content coding.\n# TYPE zipfs_response_bytes_total counter\n")
+	codings := make([]string, 0, len(metrics.bytes))
+	for coding := range metrics.bytes {
+		codings = append(codings, coding)
+	}
+	slices.Sort(codings)
+	for _, coding := range codings {
+		fmt.Fprintf(w, "zipfs_response_bytes_total{encoding=%q} %d\n", coding, metrics.bytes[coding])
+	}
+	fmt.Fprintf(w, "# HELP zipfs_request_duration_seconds Time taken to answer requests.\n# TYPE zipfs_request_duration_seconds histogram\n")
+	var n int64
+	for i, le := range latencyBuckets {
+		n += metrics.latency[i]
+		fmt.Fprintf(w, "zipfs_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), n)
+	}
+	fmt.Fprintf(w, "zipfs_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", metrics.latencyCount)
+	fmt.Fprintf(w, "zipfs_request_duration_seconds_sum %g\n", metrics.latencySum)
+	fmt.Fprintf(w, "zipfs_request_duration_seconds_count %d\n", metrics.latencyCount)
+	fmt.Fprintf(w, "# HELP zipfs_open_archives Archives open for serving.\n# TYPE zipfs_open_archives gauge\n")
+	fmt.Fprintf(w, "zipfs_open_archives %d\n", len(archives))
+	fmt.Fprintf(w, "# HELP zipfs_archive_cache_hits_total Requests that found their archive already open.\n# TYPE zipfs_archive_cache_hits_total counter\n")
+	fmt.Fprintf(w, "zipfs_archive_cache_hits_total %d\n", archiveHits.Load())
+	fmt.Fprintf(w, "# HELP zipfs_archive_cache_misses_total Requests that had to open their archive.\n# TYPE zipfs_archive_cache_misses_total counter\n")
+	fmt.Fprintf(w, "zipfs_archive_cache_misses_total %d\n", archiveMisses.Load())
+	fmt.Fprintf(w, "# HELP zipfs_mime_cache_entries Entries with their content type worked out.\n# TYPE zipfs_mime_cache_entries gauge\n")
+	fmt.Fprintf(w, "zipfs_mime_cache_entries %d\n", mimeCached)
+}
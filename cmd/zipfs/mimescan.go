@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var sniffOnOpen *bool = flag.Bool("sniff-on-open", false, "work out every entry's content type in the background after opening an archive, which reads the start of every one of them")
+
+// Fills in the MIME cache for everything under the base directory, so
+// that no request has to wait on sniffing. It gives way to requests
+// between entries, and gives up if the archive stops being served
+// before it's done. Called with a reference held, which it releases.
+func (z *zipFS) PrecomputeMime() {
+	defer z.Release()
+	start := time.Now()
+	n := 0
+	for _, f := range z.File {
+		if z.refs.Load() == 1 {
+			// Nobody else is holding on to it
+			return
+		}
+		if strings.HasSuffix(f.Name, "/") || isControlFile(f.Name) {
+			continue
+		}
+		if z.base != "" && !strings.HasPrefix(f.Name, z.base+"/") {
+			continue
+		}
+		if _, err := z.MimeType(f); err != nil {
+			slog.Debug("sniffing", "name", f.Name, "err", err)
+		}
+		n++
+		runtime.Gosched()
+	}
+	slog.Debug("content types ready", "name", z.name, "entries", n, "elapsed", time.Since(start))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"path"
+	"strings"
+)
+
+// An archive can pin the Content-Type of particular files in this file
+// at the top of the served directory, one per line:
+//
+//	/data/feed      application/atom+xml
+//	/bin/tool.exe   application/vnd.microsoft.portable-executable
+//
+// These win over the extension and over sniffing.
+const mimeTypesFile = ".zipfs.mimetypes"
+
+func parseMimeTypes(r io.Reader) (map[string]string, error) {
+	types := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, ctype, ok := strings.Cut(line, " ")
+		if !ok {
+			name, ctype, ok = strings.Cut(line, "\t")
+		}
+		ctype = strings.TrimSpace(ctype)
+		if !ok || ctype == "" {
+			return nil, fmt.Errorf("%q: want path and type", line)
+		}
+		if _, _, err := mime.ParseMediaType(ctype); err != nil {
+			return nil, fmt.Errorf("%q: %w", ctype, err)
+		}
+		types[strings.TrimPrefix(path.Clean("/"+name), "/")] = ctype
+	}
+	return types, s.Err()
+}
+
+// Reads the types pinned by the archive, by the entries they're for.
+func loadMimeTypes(zr *zip.Reader, base string) map[*zip.File]string {
+	name := path.Join(base, mimeTypesFile)
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	types, err := parseMimeTypes(f)
+	if err != nil {
+		slog.Error("ignoring bad MIME types", "name", name, "err", err)
+		return nil
+	}
+	pinned := make(map[*zip.File]string)
+	for _, f := range zr.File {
+		name := f.Name
+		if base != "" {
+			var ok bool
+			if name, ok = strings.CutPrefix(name, base+"/"); !ok {
+				continue
+			}
+		}
+		if ctype, ok := types[name]; ok {
+			pinned[f] = ctype
+		}
+	}
+	return pinned
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+var mounts Mounts
+
+func init() {
+	flag.Func("mount", "PREFIX=path/to/archive.zip, or PREFIX=path/to/archive.zip!/dir/ for just that directory in it, to serve the archive under the URL path PREFIX, with the longest PREFIX that matches winning; instead of -name or -root (repeatable)", func(s string) error {
+		prefix, name, ok := strings.Cut(s, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") || name == "" {
+			return fmt.Errorf("want /PREFIX/=path/to/archive.zip")
+		}
+		name, base, _ := strings.Cut(name, "!")
+		prefix = strings.TrimSuffix(path.Clean(prefix), "/")
+		if slices.ContainsFunc(mounts, func(m *mount) bool { return m.prefix == prefix }) {
+			return fmt.Errorf("%s/ given twice", prefix)
+		}
+		mounts = append(mounts, &mount{prefix: prefix, name: name, base: base})
+		return nil
+	})
+}
+
+// An archive served under a URL path, without the trailing slash.
+type mount struct {
+	prefix string
+	name   string
+	base   string
+	a      *Archive
+}
+
+// The -mount archives, longest prefix first.
+type Mounts []*mount
+
+// Opens every archive in the table, and puts them in the order they're
+// matched in.
+func (ms Mounts) Open() {
+	slices.SortFunc(ms, func(a, b *mount) int {
+		return cmp.Compare(len(b.prefix), len(a.prefix))
+	})
+	for _, m := range ms {
+		slog.Info("opening archive", "name", m.name, "base", m.base, "prefix", m.prefix+"/")
+		a, err := OpenArchive(m.name, m.base)
+		if err != nil {
+			log.Fatal(err)
+		}
+		a.mount = m.prefix
+		m.a = a
+	}
+}
+
+func (ms Mounts) Archives() []*Archive {
+	var archives []*Archive
+	for _, m := range ms {
+		m.a.serving.Add(1)
+		archives = append(archives, m.a)
+	}
+	return archives
+}
+
+func (ms Mounts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, m := range ms {
+		if m.prefix != "" && r.URL.Path == m.prefix {
+			// Relative, so whatever prefix is in front stays there
+			http.Redirect(w, r, path.Base(m.prefix)+"/", http.StatusMovedPermanently)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, m.prefix+"/") {
+			http.StripPrefix(m.prefix, m.a.Limit(m.a.Alarm(Throttle(m.a)))).ServeHTTP(w, r)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
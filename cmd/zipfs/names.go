@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/jleedev/zipfs"
+)
+
+func init() {
+	flag.Func("name-type", "content type for files with a given name, as NAME=TYPE (repeatable)", func(s string) error {
+		name, ctype, ok := strings.Cut(s, "=")
+		if !ok || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("want NAME=TYPE")
+		}
+		if _, _, err := mime.ParseMediaType(ctype); err != nil {
+			return err
+		}
+		zipfs.NameTypes[name] = ctype
+		return nil
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jleedev/zipfs"
+)
+
+var nested *bool = flag.Bool("nested", true, "browse .zip files inside archives as directories, at their name with a slash on the end")
+var nestedMaxSize *int64 = flag.Int64("nested-max-size", 64<<20, "largest compressed .zip inside an archive to inflate into memory for browsing; stored ones are read in place whatever their size")
+var nestedCacheSize *int64 = flag.Int64("nested-cache-size", 256<<20, "bytes of memory for keeping inflated .zip files from inside archives open between requests, the least recently used going first")
+
+// Memory used by inflated nested archives kept open across all open
+// archives
+var nestedBytes atomic.Int64
+
+// Whether the entry is an archive that can be browsed.
+func nestable(f *zip.File) bool {
+	return *nested && strings.EqualFold(path.Ext(f.Name), ".zip") && !f.Mode().IsDir() &&
+		!zipfs.Encrypted(f) && (f.Method == zip.Store || f.UncompressedSize64 <= uint64(*nestedMaxSize))
+}
+
+// Splits name, a path under the base directory, into a .zip entry and
+// the path inside it. The .zip on its own only counts as the archive
+// when it's asked for as a directory; otherwise it's just a file.
+func (z *zipFS) NestedPath(name string, dir bool) (*zip.File, string, bool) {
+	if !*nested {
+		return nil, "", false
+	}
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && name[i] != '/' {
+			continue
+		}
+		prefix := name[:i]
+		if !strings.EqualFold(path.Ext(prefix), ".zip") || i == len(name) && !dir {
+			continue
+		}
+		if f := z.Entry(path.Join(z.base, prefix)); f != nil && nestable(f) {
+			return f, strings.TrimPrefix(name[i:], "/"), true
+		}
+	}
+	return nil, "", false
+}
+
+// Opens the archive in the entry, or returns the one already open,
+// which must be released by the caller.
+func (z *zipFS) Nested(f *zip.File) (*zipFS, error) {
+	z.rw.Lock()
+	nz := z.nested[f]
+	if nz != nil {
+		nz.refs.Add(1)
+		if _, ok := z.nestedUsed[f]; ok {
+			z.nestedUsed[f] = time.Now()
+		}
+	}
+	z.rw.Unlock()
+	if nz != nil {
+		return nz, nil
+	}
+	var raw io.ReaderAt
+	if f.Method == zip.Store {
+		sr, err := z.RawSeeker(f)
+		if err != nil {
+			return nil, err
+		}
+		raw = sr
+	} else {
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		raw = bytes.NewReader(data)
+	}
+	zfs, err := zipfs.OpenArchive(f.Name, raw, int64(f.UncompressedSize64))
+	if err != nil {
+		return nil, err
+	}
+	nz = newZipFS(z.name+"/"+f.Name, nil, raw, f.FileInfo(), zfs, "")
+	z.rw.Lock()
+	defer z.rw.Unlock()
+	// Someone else got there first
+	if other := z.nested[f]; other != nil {
+		nz.Release()
+		other.refs.Add(1)
+		return other, nil
+	}
+	// Inflated ones are only kept if there's room, and otherwise go
+	// when the caller's done
+	if f.Method != zip.Store && !z.makeRoom(f) {
+		return nz, nil
+	}
+	z.nested[f] = nz
+	nz.refs.Add(1)
+	return nz, nil
+}
+
+// Makes room under -nested-cache-size for the inflated archive in f,
+// closing this archive's least recently used ones if need be. Called
+// with z.rw held.
+func (z *zipFS) makeRoom(f *zip.File) bool {
+	size := int64(f.UncompressedSize64)
+	if size > *nestedCacheSize {
+		return false
+	}
+	for nestedBytes.Add(size) > *nestedCacheSize {
+		nestedBytes.Add(-size)
+		var oldest *zip.File
+		for g, t := range z.nestedUsed {
+			if oldest == nil || t.Before(z.nestedUsed[oldest]) {
+				oldest = g
+			}
+		}
+		if oldest == nil {
+			return false
+		}
+		z.dropNested(oldest)
+	}
+	z.nestedUsed[f] = time.Now()
+	return true
+}
+
+// Lets go of a nested archive. Called with z.rw held.
+func (z *zipFS) dropNested(f *zip.File) {
+	z.nested[f].Release()
+	delete(z.nested, f)
+	if _, ok := z.nestedUsed[f]; ok {
+		delete(z.nestedUsed, f)
+		nestedBytes.Add(-int64(f.UncompressedSize64))
+	}
+}
+
+// Serves rest from inside the archive in the entry.
+func (z *zipFS) ServeNested(w http.ResponseWriter, r *http.Request, f *zip.File, rest string) {
+	nz, err := z.Nested(f)
+	if errors.Is(err, zip.ErrFormat) {
+		z.NotFound(w, r)
+		return
+	} else if err != nil {
+		z.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer nz.Release()
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = "/" + rest
+	if rest != "" && strings.HasSuffix(r.URL.Path, "/") {
+		r2.URL.Path += "/"
+	}
+	r2.URL.RawPath = ""
+	nz.ServeHTTP(w, r2)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var errBadPath = errors.New("bad request path")
+
+var slashes = regexp.MustCompile(`//+`)
+
+// Checks the request path before anything looks it up. Whatever sits
+// in front of zipfs may have rewritten it, so this doesn't trust it to
+// be tidy: dot segments, however they're spelled, NUL bytes,
+// backslashes, and invalid UTF-8 (which includes overlong encodings)
+// are refused outright, and runs of slashes are collapsed.
+func NormalizePath(escaped, decoded string) (string, string, error) {
+	for _, seg := range strings.Split(escaped, "/") {
+		if strings.Contains(seg, "%") {
+			if s := strings.ReplaceAll(strings.ToLower(seg), "%2e", "."); s == "." || s == ".." {
+				return "", "", errBadPath
+			}
+		}
+	}
+	if strings.ContainsAny(decoded, "\x00\\") || !utf8.ValidString(decoded) {
+		return "", "", errBadPath
+	}
+	for _, seg := range strings.Split(decoded, "/") {
+		if seg == "." || seg == ".." {
+			return "", "", errBadPath
+		}
+	}
+	return slashes.ReplaceAllString(escaped, "/"), slashes.ReplaceAllString(decoded, "/"), nil
+}
+
+func Normalize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		escaped, decoded, err := NormalizePath(r.URL.EscapedPath(), r.URL.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if decoded != r.URL.Path {
+			r = r.Clone(r.Context())
+			r.URL.Path = decoded
+			r.URL.RawPath = ""
+			if escaped != r.URL.EscapedPath() {
+				r.URL.RawPath = escaped
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePath(t *testing.T) {
+	for _, tt := range []struct {
+		escaped, want string
+		bad           bool
+	}{
+		{escaped: "/a/b.txt", want: "/a/b.txt"},
+		{escaped: "//a///b/", want: "/a/b/"},
+		{escaped: "/a%20b", want: "/a%20b"},
+		{escaped: "/a..b/c", want: "/a..b/c"},
+		{escaped: "/a/../b", bad: true},
+		{escaped: "/a/./b", bad: true},
+		{escaped: "/a/%2e%2E/b", bad: true},
+		{escaped: "/a/.%2e", bad: true},
+		{escaped: "/a/%2e/b", bad: true},
+		{escaped: "/a%00b", bad: true},
+		{escaped: "/a%5cb", bad: true},
+		{escaped: "/%c0%ae%c0%ae/etc", bad: true},
+		{escaped: "/%ff", bad: true},
+	} {
+		decoded, err := url.PathUnescape(tt.escaped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		escaped, _, err := NormalizePath(tt.escaped, decoded)
+		if tt.bad {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", tt.escaped, escaped)
+			}
+			continue
+		}
+		if err != nil || escaped != tt.want {
+			t.Errorf("%s: got %s, %v, want %s", tt.escaped, escaped, err, tt.want)
+		}
+	}
+}
+
+func FuzzNormalize(f *testing.F) {
+	for _, s := range []string{"/", "/a/b", "//a//b//", "/a/../b", "/%2e%2e/", "/a%2fb", "/%c0%ae", "/a\\b", "/.", "/a..b"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, escaped string) {
+		decoded, err := url.PathUnescape(escaped)
+		if err != nil {
+			return
+		}
+		e1, d1, err := NormalizePath(escaped, decoded)
+		if err != nil {
+			return
+		}
+		if slices.ContainsFunc(strings.Split(d1, "/"), func(seg string) bool { return seg == ".." }) {
+			t.Errorf("%q: .. in %q", escaped, d1)
+		}
+		e2, d2, err := NormalizePath(e1, d1)
+		if err != nil || e2 != e1 || d2 != d1 {
+			t.Errorf("%q: normalized to %q %q, then to %q %q, %v", escaped, e1, d1, e2, d2, err)
+		}
+	})
+}
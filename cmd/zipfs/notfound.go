@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+// How long a path is remembered as missing. The archive can't change
+// underneath a zipFS, so this only bounds the memory, along with
+// notFoundMax.
+const notFoundTTL = 30 * time.Second
+
+const notFoundMax = 10000
+
+// Reports whether the name was looked up and not found recently.
+func (z *zipFS) KnownMissing(name string) bool {
+	z.rw.RLock()
+	t, ok := z.notFound[name]
+	z.rw.RUnlock()
+	return ok && time.Since(t) < notFoundTTL
+}
+
+// Remembers that the name isn't in the archive.
+func (z *zipFS) Missing(name string) {
+	now := time.Now()
+	z.rw.Lock()
+	defer z.rw.Unlock()
+	if len(z.notFound) >= notFoundMax {
+		for k, t := range z.notFound {
+			if now.Sub(t) >= notFoundTTL {
+				delete(z.notFound, k)
+			}
+		}
+		// Everything's recent, so somebody is making up names
+		if len(z.notFound) >= notFoundMax {
+			clear(z.notFound)
+		}
+	}
+	z.notFound[name] = now
+}
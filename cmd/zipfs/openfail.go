@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// How long an archive that couldn't be opened is left alone before
+// trying again, doubling each time it fails again.
+const (
+	openRetryMin = time.Second
+	openRetryMax = 5 * time.Minute
+)
+
+// An archive under -root that couldn't be opened.
+type openFailure struct {
+	err   error
+	until time.Time
+	wait  time.Duration
+}
+
+// Returns the error from opening name last time, if it's too soon to
+// try again. Called with s.mu held.
+func (s *ZipServer) recentFailure(name string) error {
+	if f, ok := s.failed[name]; ok && time.Now().Before(f.until) {
+		return f.err
+	}
+	return nil
+}
+
+// Remembers that name couldn't be opened, backing off further if it
+// couldn't last time either. Only the first failure in a row is logged
+// as an error. Called with s.mu held.
+func (s *ZipServer) openFailed(name string, err error, log *slog.Logger) {
+	f, ok := s.failed[name]
+	if !ok {
+		log.Error("can't open archive", "name", name, "err", err)
+		f = &openFailure{wait: openRetryMin}
+		s.failed[name] = f
+	} else {
+		f.wait = min(2*f.wait, openRetryMax)
+		log.Debug("still can't open archive", "name", name, "err", err, "retry", f.wait)
+	}
+	f.err, f.until = err, time.Now().Add(f.wait)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jleedev/zipfs"
+)
+
+var overlays []string
+
+func init() {
+	flag.Func("overlay", "with -name, an archive to layer over it, whose files shadow any with the same name underneath and whose directories merge with the ones there; later ones go on top (repeatable)", func(s string) error {
+		overlays = append(overlays, s)
+		return nil
+	})
+}
+
+// An archive layered over the one being served.
+type layer struct {
+	name string
+	file *os.File
+	info os.FileInfo
+}
+
+// Opens the -overlay archives and puts them on top of zfs.
+func openOverlays(zfs *zipfs.FS) (*zipfs.FS, []layer, error) {
+	stack := []*zipfs.FS{zfs}
+	var layers []layer
+	for _, name := range overlays {
+		l, lfs, err := openLayer(name)
+		if err != nil {
+			closeLayers(layers)
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		layers = append(layers, l)
+		stack = append(stack, lfs)
+	}
+	return zipfs.Overlay(stack...), layers, nil
+}
+
+func openLayer(name string) (layer, *zipfs.FS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return layer{}, nil, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		var zfs *zipfs.FS
+		if zfs, err = zipfs.OpenArchive(name, f, info.Size()); err == nil {
+			return layer{name, f, info}, zfs, nil
+		}
+	}
+	f.Close()
+	return layer{}, nil, err
+}
+
+func closeLayers(layers []layer) {
+	for _, l := range layers {
+		l.file.Close()
+	}
+}
+
+// Whether any of the overlays isn't the file it was when it was opened.
+func (z *zipFS) layersChanged() bool {
+	for _, l := range z.layers {
+		info, err := os.Stat(l.name)
+		if err != nil {
+			continue
+		}
+		if !os.SameFile(info, l.info) || info.Size() != l.info.Size() || !info.ModTime().Equal(l.info.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
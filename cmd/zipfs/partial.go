@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jleedev/zipfs"
+)
+
+var partial *bool = flag.Bool("partial", false, "serve what's there so far of archives without a central directory, such as ones still being written, picking up new entries as -reload-interval notices them")
+
+// Scans of archives being written, by path, so each reopen only has to
+// read what's been added.
+var partials = struct {
+	sync.Mutex
+	m map[string]*partialScan
+}{m: make(map[string]*partialScan)}
+
+type partialScan struct {
+	info os.FileInfo
+	p    *zipfs.Partial
+}
+
+// Opens the complete entries so far of an archive that has no central
+// directory yet.
+func OpenPartial(name string, raw io.ReaderAt, info os.FileInfo) (*zipfs.FS, error) {
+	partials.Lock()
+	ps, ok := partials.m[name]
+	if !ok || !os.SameFile(ps.info, info) {
+		ps = &partialScan{info: info, p: &zipfs.Partial{}}
+		partials.m[name] = ps
+	}
+	partials.Unlock()
+	ra, size := ps.p.Scan(raw, info.Size())
+	return zipfs.New(ra, size)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"flag"
+	"net/http"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jleedev/zipfs"
+)
+
+// Passwords for encrypted entries, by archive file name, with "" for
+// the ones to try on any archive.
+var zipPasswords = make(map[string][]string)
+
+func init() {
+	flag.Func("zip-password", "password for encrypted entries, or NAME.zip=PASSWORD for just the archive with that file name (repeatable); clients can send their own in an X-Zip-Password header or as the basic auth password", func(s string) error {
+		archive, password, ok := strings.Cut(s, "=")
+		if !ok || !strings.EqualFold(filepath.Ext(archive), ".zip") {
+			archive, password = "", s
+		}
+		zipPasswords[archive] = append(zipPasswords[archive], password)
+		return nil
+	})
+}
+
+// Sends an encrypted entry decrypted with the client's password if it
+// sent one that works, or else one from -zip-password, or asks for
+// one. The client's might only be its password for -htpasswd or an
+// access file, so it doesn't stand in the way of the others.
+func (z *zipFS) ServeEncrypted(w http.ResponseWriter, r *http.Request, f *zip.File) {
+	fromClient := zipfs.Password(r)
+	candidates := slices.Concat(zipPasswords[filepath.Base(z.name)], zipPasswords[""])
+	if fromClient != "" {
+		candidates = slices.Concat([]string{fromClient}, candidates)
+	}
+	for i, password := range candidates {
+		rs, err := z.DecryptSeeker(f, password)
+		if errors.Is(err, zipfs.ErrPassword) {
+			continue
+		} else if err != nil {
+			z.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rs.Close()
+		if fromClient != "" && i == 0 {
+			// Not for shared caches, which don't know about X-Zip-Password
+			w.Header().Set("Cache-Control", "private")
+		} else if cc, ok := z.cacheControl[f]; ok {
+			w.Header().Set("Cache-Control", cc)
+		}
+		// AE-2 entries have no CRC to make one from
+		if f.CRC32 != 0 {
+			w.Header().Set("ETag", FileETag(f))
+		}
+		// Sniffed by ServeContent from the decrypted data if the name
+		// doesn't say
+		if ctype, ok := zipfs.TypeByName(f.Name); ok {
+			w.Header().Set("Content-Type", ctype)
+		}
+		http.ServeContent(w, r, path.Base(f.Name), f.Modified, rs)
+		return
+	}
+	z.Permit(w, r, http.StatusUnauthorized, "encrypted "+path.Base(f.Name))
+}
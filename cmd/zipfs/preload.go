@@ -0,0 +1,85 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var preload *bool = flag.Bool("preload", false, "send Link: rel=preload headers for stylesheets and scripts used by HTML files")
+var earlyHints *bool = flag.Bool("early-hints", false, "also send preload links in a 103 Early Hints response")
+
+// Only look this far into a document for things to preload
+const preloadScanLimit = 64 << 10
+
+// Returns the Link header values for the stylesheets and scripts that
+// an HTML entry loads, scanning it the first time if scan is set.
+func (z *zipFS) PreloadLinks(f *zip.File, scan bool) []string {
+	z.rw.RLock()
+	links, ok := z.preload[f]
+	z.rw.RUnlock()
+	if ok || !scan {
+		return links
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	links = ScanPreloads(io.LimitReader(r, preloadScanLimit))
+	z.rw.Lock()
+	z.preload[f] = links
+	z.rw.Unlock()
+	return links
+}
+
+// Picks out the stylesheets and scripts from the head of a document.
+// Links are kept relative, which resolves the same way in the header
+// as it does in the document (unless there's a <base>, then give up).
+func ScanPreloads(r io.Reader) []string {
+	var links []string
+	add := func(href, as string) {
+		u, err := url.Parse(href)
+		if err != nil || u.Scheme != "" || u.Host != "" || href == "" || strings.ContainsAny(href, "<>") {
+			return
+		}
+		links = append(links, fmt.Sprintf("<%s>; rel=preload; as=%s", href, as))
+	}
+	t := html.NewTokenizer(r)
+	for {
+		switch t.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := t.Token()
+			attr := func(key string) string {
+				for _, a := range tok.Attr {
+					if a.Key == key {
+						return a.Val
+					}
+				}
+				return ""
+			}
+			switch tok.DataAtom {
+			case atom.Base:
+				return nil
+			case atom.Body:
+				return links
+			case atom.Link:
+				if strings.EqualFold(attr("rel"), "stylesheet") {
+					add(attr("href"), "style")
+				}
+			case atom.Script:
+				if src := attr("src"); src != "" {
+					add(src, "script")
+				}
+			}
+		}
+	}
+}
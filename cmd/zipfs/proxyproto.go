@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a client gets to send the PROXY header
+const proxyHeaderTimeout = 5 * time.Second
+
+var errProxyHeader = errors.New("bad PROXY protocol header")
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Wraps connections accepted from a load balancer speaking the PROXY
+// protocol (v1 or v2), so that RemoteAddr is the real client.
+type ProxyListener struct {
+	net.Listener
+}
+
+func (l ProxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: c}, nil
+}
+
+// The socket underneath, to pass on to another process.
+func (l ProxyListener) File() (*os.File, error) {
+	fl, ok := l.Listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("can't pass on %T", l.Listener)
+	}
+	return fl.File()
+}
+
+// The header is read on first use, which happens in the connection's
+// own goroutine rather than holding up Accept.
+type proxyConn struct {
+	net.Conn
+	once   sync.Once
+	r      *bufio.Reader
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.r = bufio.NewReader(c.Conn)
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.Conn.Close()
+		}
+		if c.remote == nil {
+			c.remote = c.Conn.RemoteAddr()
+		}
+	})
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+// Returns the source address from the header, or nil if the proxy
+// didn't pass one along (health checks and such).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	return readProxyV1(r)
+}
+
+// PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	// The longest possible header is 107 bytes
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errProxyHeader
+	}
+	fields := strings.Split(s, " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, errProxyHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errProxyHeader
+	}
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, errProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errProxyHeader
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	verCmd, family := hdr[12], hdr[13]
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: version %d", errProxyHeader, verCmd>>4)
+	}
+	// LOCAL, meaning the proxy itself is talking
+	if verCmd&0xf == 0 {
+		return nil, nil
+	}
+	var size int
+	switch family >> 4 {
+	case 1:
+		size = 4
+	case 2:
+		size = 16
+	default:
+		// Unix sockets and the like, no address worth reporting
+		return nil, nil
+	}
+	if len(body) < 2*size+4 {
+		return nil, errProxyHeader
+	}
+	addr, _ := netip.AddrFromSlice(body[:size])
+	port := binary.BigEndian.Uint16(body[2*size:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, port)), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var purgeMethod *string = flag.String("purge-method", "PURGE", "method for -purge-url requests, such as PURGE, BAN, or POST")
+
+var purgeURLs []string
+var purgeHeaders []string
+
+func init() {
+	flag.Func("purge-url", "URL to send a request to whenever an archive is replaced, so a CDN or cache in front drops the old one; {prefix} is replaced with the URL path it's served under (repeatable)", func(s string) error {
+		purgeURLs = append(purgeURLs, s)
+		return nil
+	})
+	flag.Func("purge-header", "header to send with purge requests, as \"Name: value\", with {prefix} replaced the same way (repeatable)", func(s string) error {
+		if _, _, ok := strings.Cut(s, ":"); !ok {
+			return fmt.Errorf("want Name: value")
+		}
+		purgeHeaders = append(purgeHeaders, s)
+		return nil
+	})
+}
+
+const purgeTimeout = 10 * time.Second
+
+// The URL path the archive is served under.
+func (a *Archive) MountPath() string {
+	p := *prefix + a.mount
+	if *root != "" {
+		if rel, err := filepath.Rel(*root, a.Path); err == nil {
+			p += "/" + filepath.ToSlash(rel)
+		}
+	}
+	return p + "/"
+}
+
+// Tells the caches in front that the archive changed. Failures are
+// only logged, since the new archive is being served either way.
+func (a *Archive) Purge() {
+	mount := a.MountPath()
+	for _, u := range purgeURLs {
+		req, err := http.NewRequest(*purgeMethod, strings.ReplaceAll(u, "{prefix}", mount), nil)
+		if err != nil {
+			slog.Error("purge", "url", u, "err", err)
+			continue
+		}
+		for _, h := range purgeHeaders {
+			name, value, _ := strings.Cut(h, ":")
+			req.Header.Add(strings.TrimSpace(name), strings.ReplaceAll(strings.TrimSpace(value), "{prefix}", mount))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		cancel()
+		if err != nil {
+			slog.Error("purge", "url", req.URL, "err", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Error("purge", "url", req.URL, "status", resp.Status)
+			continue
+		}
+		slog.Info("purged", "url", req.URL, "prefix", mount)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+var readahead *int = flag.Int("readahead", 0, "when a client asks for the files in a directory one after another in order by name, like video segments or numbered images, have this many of the next ones read from disk ahead of it")
+
+// Stop keeping track of clients past this many
+const readaheadClients = 4096
+
+// The files of each directory in order by name, which is the order
+// they're listed in and, usually, played or shown in, for -readahead.
+type readOrder struct {
+	dirs map[string][]*zip.File
+	pos  map[*zip.File]int
+}
+
+// Where a client has got to in a directory: the last file it asked
+// for, and the last one read ahead of it.
+type readPosition struct {
+	last, ahead int
+}
+
+// Orders files, which have to be from the archive in z.file and not
+// an overlay on it.
+func newReadOrder(z *zipFS, files []*zip.File) *readOrder {
+	o := &readOrder{dirs: make(map[string][]*zip.File), pos: make(map[*zip.File]int)}
+	for _, f := range files {
+		// Not other copies, or files an overlay shadows, which aren't
+		// what's served
+		if f.Mode().IsDir() || z.Entry(f.Name) != f {
+			continue
+		}
+		dir := path.Dir(f.Name)
+		o.dirs[dir] = append(o.dirs[dir], f)
+	}
+	for _, files := range o.dirs {
+		slices.SortFunc(files, func(a, b *zip.File) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+		for i, f := range files {
+			o.pos[f] = i
+		}
+	}
+	return o
+}
+
+// Notes that the client asked for f, and if that's the file after the
+// last one it asked for in the same directory, reads the next few
+// ahead.
+func (z *zipFS) ReadAhead(r *http.Request, f *zip.File) {
+	if z.order == nil || z.file == nil {
+		return
+	}
+	i, ok := z.order.pos[f]
+	if !ok {
+		return
+	}
+	dir := path.Dir(f.Name)
+	key := ClientIP(r).String() + " " + dir
+	z.rw.Lock()
+	prev, seen := z.reading[key]
+	cur := readPosition{last: i, ahead: i}
+	files := z.order.dirs[dir]
+	var from, to int
+	sequential := seen && prev.last+1 == i
+	if sequential {
+		from, to = max(prev.ahead, i)+1, min(i+*readahead, len(files)-1)
+		cur.ahead = max(prev.ahead, to)
+		sequential = from <= to
+	}
+	if len(z.reading) >= readaheadClients {
+		clear(z.reading)
+	}
+	z.reading[key] = cur
+	z.rw.Unlock()
+	if !sequential {
+		return
+	}
+	requestLog(r).Debug("reading ahead", "from", files[from].Name, "to", files[to].Name)
+	for _, f := range files[from : to+1] {
+		if off, err := f.DataOffset(); err == nil {
+			z.prefetch(off, int64(f.CompressedSize64))
+		}
+	}
+}
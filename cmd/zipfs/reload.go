@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+)
+
+var reloadInterval *time.Duration = flag.Duration("reload-interval", time.Second, "how often to check whether an archive changed on disk and reopen it, or 0 to never")
+
+// Reopens the archive if the file at its path isn't the one being
+// served any more, checking at most once per -reload-interval. A file
+// that's replaced by a rename is safe to keep serving until the new
+// one opens, but one that's rewritten in place isn't, and returns
+// false until it can be read again.
+func (a *Archive) Refresh() bool {
+	if *reloadInterval <= 0 {
+		return true
+	}
+	last, now := a.checked.Load(), time.Now().UnixNano()
+	if now-last < int64(*reloadInterval) || !a.checked.CompareAndSwap(last, now) {
+		return !a.unavailable.Load()
+	}
+	// An upload or rollback is already taking care of it
+	if !a.deploy.TryLock() {
+		return !a.unavailable.Load()
+	}
+	defer a.deploy.Unlock()
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		// The open file is all there is now
+		return !a.unavailable.Load()
+	}
+	a.mu.RLock()
+	cur := a.cur
+	a.mu.RUnlock()
+	inPlace := os.SameFile(info, cur.info)
+	same := inPlace && info.Size() == cur.info.Size() && info.ModTime().Equal(cur.info.ModTime())
+	if same && !cur.layersChanged() && !cur.settingsChanged() {
+		return !a.unavailable.Load()
+	}
+	// With -partial, it's taken to be growing, and what's been read
+	// of it already stays put
+	if inPlace && !same && !*partial {
+		a.unavailable.Store(true)
+	}
+	z, err := OpenZipFS(a.Path, a.base)
+	if err != nil {
+		slog.Warn("archive changed but can't be reopened", "name", a.Path, "err", err)
+		return !a.unavailable.Load()
+	}
+	slog.Info("archive changed, reopened", "name", a.Path)
+	a.Swap(z)
+	a.unavailable.Store(false)
+	return true
+}
+
+// Reopens the archive and its canary whether they've changed or not,
+// dropping the versions opened on request.
+func (a *Archive) Reload() {
+	a.deploy.Lock()
+	z, err := OpenZipFS(a.Path, a.base)
+	if err != nil {
+		slog.Warn("can't reopen archive", "name", a.Path, "err", err)
+	} else {
+		a.Swap(z)
+		a.unavailable.Store(false)
+	}
+	a.deploy.Unlock()
+	a.pinMu.Lock()
+	for v, z := range a.pinned {
+		z.Release()
+		delete(a.pinned, v)
+	}
+	a.pinMu.Unlock()
+	if a.canary != nil {
+		a.canary.Reload()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+)
+
+// Renders a page through a buffer in front of w. If a template fails,
+// which one from -template-dir can easily do, it's logged, and as long
+// as none of the page has been sent yet the plain fallback is sent
+// instead. Once some of it has, all that can be done is to cut the
+// response off, so it doesn't look complete.
+func renderPage(w io.Writer, r *http.Request, name string, render func(io.Writer) error, fallback func(io.Writer)) {
+	sw := &sentWriter{w: w}
+	bw := bufio.NewWriterSize(sw, 32<<10)
+	err := render(bw)
+	if err == nil {
+		bw.Flush()
+		return
+	}
+	if sw.err != nil {
+		// The client went away
+		return
+	}
+	requestLog(r).Error("template failed", "template", name, "err", err)
+	if sw.sent {
+		panic(http.ErrAbortHandler)
+	}
+	fallback(w)
+}
+
+type sentWriter struct {
+	w    io.Writer
+	sent bool
+	err  error
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = true
+	n, err := s.w.Write(p)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// The listing as bare links, for when dir.html fails.
+func plainListing(w io.Writer, l Listing) {
+	fmt.Fprintf(w, "<!doctype html><meta charset=utf-8>\n<title>%s</title>\n<ul>\n", template.HTMLEscapeString(DisplayName(l.Path)))
+	if l.Parent {
+		io.WriteString(w, "<li><a href=\"../\">../</a>\n")
+	}
+	for e := range l.Rows() {
+		name := e.Name()
+		if e.IsDir() || e.Nested {
+			name += "/"
+		}
+		plainLink(w, name)
+	}
+	io.WriteString(w, "</ul>\n")
+}
+
+// The archives as bare links, for when landing.html fails.
+func plainLanding(w io.Writer, l Landing) {
+	io.WriteString(w, "<!doctype html><meta charset=utf-8>\n<ul>\n")
+	for _, e := range l.Entries {
+		plainLink(w, e.Name+"/")
+	}
+	io.WriteString(w, "</ul>\n")
+}
+
+func plainLink(w io.Writer, name string) {
+	fmt.Fprintf(w, "<li><a href=\"%s\">%s</a>\n", template.HTMLEscapeString(Href(name)), template.HTMLEscapeString(DisplayName(name)))
+}
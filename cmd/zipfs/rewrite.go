@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An archive can carry its own rewrite rules in this file at the top
+// of the served directory, one per line:
+//
+//	^/blog/(\d+)/(.*)$  /posts/$1-$2.html
+//	^/old/(.*)$         /new/$1            R=301
+//
+// The pattern is matched against the request path and the first rule
+// that matches is used. Without a flag, the target is served in place
+// of the original path; with R (or R=code) the client is redirected.
+const rewriteFile = ".zipfsrewrite"
+
+type rewriteRule struct {
+	re       *regexp.Regexp
+	target   string
+	redirect int
+}
+
+func parseRewrites(r io.Reader) ([]rewriteRule, error) {
+	var rules []rewriteRule
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%q: want pattern, target, and maybe flags", s.Text())
+		}
+		re, err := regexp.Compile(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		rule := rewriteRule{re: re, target: fields[1]}
+		if len(fields) == 3 {
+			flag, code, _ := strings.Cut(fields[2], "=")
+			if flag != "R" {
+				return nil, fmt.Errorf("unknown flag %q", fields[2])
+			}
+			rule.redirect = http.StatusFound
+			if code != "" {
+				rule.redirect, err = strconv.Atoi(code)
+				if err != nil || rule.redirect < 300 || rule.redirect > 399 {
+					return nil, fmt.Errorf("bad redirect status %q", code)
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, s.Err()
+}
+
+func loadRewrites(zr *zip.Reader, base string) []rewriteRule {
+	name := path.Join(base, rewriteFile)
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	rules, err := parseRewrites(f)
+	if err != nil {
+		slog.Error("ignoring bad rewrite rules", "name", name, "err", err)
+		return nil
+	}
+	return rules
+}
+
+// Files that configure zipfs rather than being part of the site.
+func isControlFile(name string) bool {
+	switch path.Base(name) {
+	case accessFile, rewriteFile, mimeTypesFile, hideFile, asOfFile, ".nolisting", ".nopassthrough", ".spa":
+		return true
+	}
+	return false
+}
+
+// The part of the request path that was stripped off before it got
+// to the archive.
+func MountPrefix(r *http.Request) string {
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, r.URL.Path)
+}
+
+// Applies the first matching rewrite rule. Returns the request to carry
+// on with, or nil after sending a redirect.
+func (z *zipFS) Rewrite(w http.ResponseWriter, r *http.Request) *http.Request {
+	for _, rule := range z.rewrites {
+		m := rule.re.FindStringSubmatchIndex(r.URL.Path)
+		if m == nil {
+			continue
+		}
+		target := string(rule.re.ExpandString(nil, rule.target, r.URL.Path, m))
+		if rule.redirect != 0 {
+			// Site-relative targets stay under the prefix
+			if strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//") {
+				target = MountPrefix(r) + target
+			}
+			http.Redirect(w, r, target, rule.redirect)
+			return nil
+		}
+		u, err := url.Parse(target)
+		if err != nil {
+			http.Error(w, "bad rewrite target", http.StatusInternalServerError)
+			return nil
+		}
+		r2 := r.Clone(r.Context())
+		// Cleaned like the mux would, so it can't climb out of the base
+		r2.URL.Path, r2.URL.RawPath = path.Clean("/"+u.Path), ""
+		if strings.HasSuffix(u.Path, "/") && r2.URL.Path != "/" {
+			r2.URL.Path += "/"
+		}
+		if u.RawQuery != "" {
+			r2.URL.RawQuery = u.RawQuery
+		}
+		requestLog(r).Debug("rewrote", "from", r.URL.Path, "to", r2.URL)
+		return r2
+	}
+	return r
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+// Like the library's, but reads the copy in -spool-dir if there's one.
+func (z *zipFS) OpenSeeker(f *zip.File) (io.ReadSeekCloser, error) {
+	if sf := z.Spooled(f); sf != nil {
+		return spoolReader{io.NewSectionReader(sf, 0, int64(f.UncompressedSize64)), sf}, nil
+	}
+	return z.FS.OpenSeeker(f)
+}
+
+type spoolReader struct {
+	io.ReadSeeker
+	f *os.File
+}
+
+func (s spoolReader) Close() error { return s.f.Close() }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var root *string = flag.String("root", "", "serve every archive under this directory as /path/to/archive.zip/inner/path, instead of just -name")
+var maxArchives *int = flag.Int("max-archives", 256, "with -root, how many archives to keep open at once, or 0 for no limit")
+
+// Serves all the archives under a directory, each one at its own path,
+// opening them the first time they're asked for. Past -max-archives,
+// the one used longest ago is closed.
+type ZipServer struct {
+	root     string
+	mu       sync.Mutex
+	archives map[string]*list.Element
+	// Most recently used at the front
+	lru *list.List
+	// For the landing page
+	counts  map[string]archiveCount
+	landing Landing
+	walked  time.Time
+	// Archives that couldn't be opened lately
+	failed map[string]*openFailure
+}
+
+type openArchive struct {
+	name string
+	a    *Archive
+}
+
+func NewZipServer(root string) *ZipServer {
+	return &ZipServer{
+		root:     root,
+		archives: make(map[string]*list.Element),
+		lru:      list.New(),
+		counts:   make(map[string]archiveCount),
+		failed:   make(map[string]*openFailure),
+	}
+}
+
+// For an archive -config doesn't let the client at.
+var errDenied = errors.New("client not allowed")
+
+// Splits a request path at the first archive in it, returning the
+// archive and the part of the path that named it, and whether it was
+// open already. Archives whose -config allow and deny rules refuse
+// the client get errDenied before anything is looked at on disk, so
+// whether they're there doesn't show.
+func (s *ZipServer) Lookup(r *http.Request) (*Archive, string, bool, error) {
+	client := ClientIP(r)
+	prefix := ""
+	for _, seg := range strings.Split(strings.TrimPrefix(path.Clean(r.URL.Path), "/"), "/") {
+		prefix += "/" + seg
+		if !strings.EqualFold(path.Ext(seg), ".zip") || strings.HasPrefix(seg, ".") {
+			continue
+		}
+		name := filepath.Join(s.root, filepath.FromSlash(prefix))
+		if !settingsFor(name).network.Permits(client) {
+			return nil, prefix, false, errDenied
+		}
+		s.mu.Lock()
+		err := s.recentFailure(name)
+		s.mu.Unlock()
+		if err != nil {
+			return nil, prefix, false, err
+		}
+		if info, err := os.Stat(name); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		a, hit, err := s.Open(name, requestLog(r))
+		return a, prefix, hit, err
+	}
+	return nil, "", false, os.ErrNotExist
+}
+
+// Returns the archive at name, opening it if need be, and whether it
+// was open already, logging to log about opening it. The caller is
+// counted as using it until it calls Done on the archive's serving.
+func (s *ZipServer) Open(name string, log *slog.Logger) (*Archive, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.archives[name]; ok {
+		s.lru.MoveToFront(e)
+		a := e.Value.(*openArchive).a
+		a.serving.Add(1)
+		archiveHits.Add(1)
+		return a, true, nil
+	}
+	log.Info("opening archive", "name", name)
+	a, err := OpenArchive(name, *base)
+	if err != nil {
+		s.openFailed(name, err, log)
+		return nil, false, err
+	}
+	delete(s.failed, name)
+	s.archives[name] = s.lru.PushFront(&openArchive{name, a})
+	for *maxArchives > 0 && s.lru.Len() > *maxArchives {
+		old := s.lru.Remove(s.lru.Back()).(*openArchive)
+		delete(s.archives, old.name)
+		slog.Debug("closing least recently used archive", "name", old.name)
+		// Nobody new can find it, so this is only waiting on requests
+		// already under way
+		go func() {
+			old.a.serving.Wait()
+			old.a.Close()
+		}()
+	}
+	a.serving.Add(1)
+	archiveMisses.Add(1)
+	return a, false, nil
+}
+
+// The archives open at the moment, which like with Open stay open
+// until the caller calls Done on each one's serving.
+func (s *ZipServer) Archives() []*Archive {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var archives []*Archive
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		a := e.Value.(*openArchive).a
+		a.serving.Add(1)
+		archives = append(archives, a)
+	}
+	return archives
+}
+
+// Closes every archive, for them to be opened fresh the next time
+// they're asked for, and forgets which ones couldn't be opened.
+func (s *ZipServer) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		old := e.Value.(*openArchive)
+		go func() {
+			old.a.serving.Wait()
+			old.a.Close()
+		}()
+	}
+	s.lru.Init()
+	clear(s.archives)
+	clear(s.failed)
+}
+
+func (s *ZipServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if *landing && r.URL.Path == "/" {
+		s.ServeLanding(w, r)
+		return
+	}
+	a, prefix, hit, err := s.Lookup(r)
+	if errors.Is(err, errDenied) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	} else if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "can't open archive", http.StatusInternalServerError)
+		return
+	}
+	defer a.serving.Done()
+	CacheStatus(w.Header(), "archive", hit)
+	if r.URL.Path == prefix {
+		// Relative, so whatever prefix is in front stays there
+		http.Redirect(w, r, path.Base(prefix)+"/", http.StatusMovedPermanently)
+		return
+	}
+	http.StripPrefix(prefix, a.Limit(a.Alarm(Throttle(a)))).ServeHTTP(w, r)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"net/http"
+	"path"
+
+	"github.com/jleedev/zipfs"
+)
+
+var noSiblings *bool = flag.Bool("no-precompressed", false, "ignore .br, .zst, and .gz files next to the ones asked for, instead of sending them to clients that take them")
+
+// Files compressed ahead of time that can be sent in place of the
+// original, in order of preference.
+var siblings = []struct{ ext, coding string }{
+	{".br", "br"},
+	{".zst", "zstd"},
+	{".gz", "gzip"},
+}
+
+// The precompressed versions of name there are in the archive.
+func (z *zipFS) Siblings(name string) map[string]*zip.File {
+	if *noSiblings {
+		return nil
+	}
+	var found map[string]*zip.File
+	for _, s := range siblings {
+		if f := z.Entry(path.Join(z.base, name) + s.ext); f != nil && !f.Mode().IsDir() && !zipfs.Encrypted(f) {
+			if found == nil {
+				found = make(map[string]*zip.File)
+			}
+			found[s.coding] = f
+		}
+	}
+	return found
+}
+
+// Sends the best of the precompressed versions the client takes, if
+// any, and returns whether it did.
+func (z *zipFS) ServeSibling(w http.ResponseWriter, r *http.Request, found map[string]*zip.File) bool {
+	for _, s := range siblings {
+		f, ok := found[s.coding]
+		if !ok || !zipfs.AcceptsEncoding(r, s.coding) {
+			continue
+		}
+		rs, err := z.OpenSeeker(f)
+		if err != nil {
+			return false
+		}
+		defer rs.Close()
+		w.Header().Set("Content-Encoding", s.coding)
+		http.ServeContent(w, r, "", f.Modified, rs)
+		return true
+	}
+	return false
+}
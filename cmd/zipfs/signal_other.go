@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+var upgradeSignal os.Signal
+
+var reloadSignal os.Signal
+
+var stopSignals = []os.Signal{os.Interrupt}
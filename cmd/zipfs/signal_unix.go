@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Asks a running server to replace itself with the binary on disk.
+var upgradeSignal os.Signal = syscall.SIGUSR2
+
+// Asks a running server to reread its config and reopen the archives.
+var reloadSignal os.Signal = syscall.SIGHUP
+
+// Ask a running server to finish what it's doing and exit.
+var stopSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
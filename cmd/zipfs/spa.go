@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"path"
+)
+
+var spa *bool = flag.Bool("spa", false, "serve -index at the top of the archive for paths that don't exist and have no extension, for single page apps; an archive can ask for this itself with a .spa file")
+
+var spaMustExist []string
+
+func init() {
+	flag.Func("spa-must-exist", "pattern like /api/* or *.js for paths that -spa still serves -index for but with a 404, so monitoring and crawlers can tell they're missing (repeatable)", func(s string) error {
+		if _, err := path.Match(s, ""); err != nil {
+			return err
+		}
+		spaMustExist = append(spaMustExist, s)
+		return nil
+	})
+}
+
+// Whether a request for name, which isn't in the archive, should get
+// the single page app instead, and with what status. Anything with an
+// extension is taken to be a real file that's missing, unless it's
+// one of the paths that must exist, which get the app with a 404.
+func (z *zipFS) Fallback(name string) (int, bool) {
+	if !boolSetting(z.settings.SPA, *spa) && !z.spa {
+		return 0, false
+	}
+	if matchPath(spaMustExist, name) || matchPath(z.settings.SPAMustExist, name) {
+		return http.StatusNotFound, true
+	}
+	return http.StatusOK, path.Ext(name) == ""
+}
+
+// Sends the app with a 404 in place of the 200 it would have had.
+type softNotFound struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *softNotFound) WriteHeader(status int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if status == http.StatusOK {
+		status = http.StatusNotFound
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *softNotFound) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *softNotFound) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var spoolDir *string = flag.String("spool-dir", "", "directory to extract large, popular compressed files to, so ranges into them are cheap")
+var spoolMinSize *int64 = flag.Int64("spool-min-size", 64<<20, "only extract files to -spool-dir from this many bytes")
+var spoolMax *int64 = flag.Int64("spool-max", 4<<30, "bytes of disk for files extracted to -spool-dir, past which an archive's least recently used ones are removed")
+
+// Requests for an entry before it's worth extracting
+const spoolMinHits = 2
+
+// Disk used in -spool-dir across all open archives
+var spoolBytes atomic.Int64
+
+// Opens the extracted copy of the entry if there is one, counting the
+// request towards making one otherwise. Each caller gets its own file,
+// so that one being removed to make room doesn't cut off anyone still
+// reading it.
+func (z *zipFS) Spooled(f *zip.File) *os.File {
+	if *spoolDir == "" || f.Method == zip.Store || f.UncompressedSize64 < uint64(*spoolMinSize) {
+		return nil
+	}
+	z.rw.Lock()
+	name, done := z.spool[f]
+	if done {
+		z.spoolUsed[f] = time.Now()
+	}
+	z.spoolHits[f]++
+	start := !done && z.spoolHits[f] == spoolMinHits
+	z.rw.Unlock()
+	if start {
+		z.refs.Add(1)
+		go z.extract(f)
+	}
+	if !done {
+		return nil
+	}
+	sf, err := os.Open(name)
+	if err != nil {
+		// Removed since
+		return nil
+	}
+	return sf
+}
+
+// Called with a reference held, which it releases.
+func (z *zipFS) extract(f *zip.File) {
+	defer z.Release()
+	size := int64(f.UncompressedSize64)
+	z.rw.Lock()
+	ok := z.makeSpoolRoom(size)
+	z.rw.Unlock()
+	if !ok {
+		slog.Debug("spool is full", "name", f.Name)
+		return
+	}
+	sf, err := os.CreateTemp(*spoolDir, "zipfs-spool-")
+	if err == nil {
+		var r io.ReadCloser
+		if r, err = f.Open(); err == nil {
+			_, err = io.Copy(sf, r)
+			r.Close()
+		}
+		if cerr := sf.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(sf.Name())
+		}
+	}
+	if err != nil {
+		spoolBytes.Add(-size)
+		slog.Warn("spooling", "name", f.Name, "err", err)
+		return
+	}
+	slog.Debug("spooled", "name", f.Name, "path", sf.Name())
+	z.rw.Lock()
+	z.spool[f] = sf.Name()
+	z.spoolUsed[f] = time.Now()
+	z.rw.Unlock()
+}
+
+// Takes size bytes of -spool-max, removing this archive's least
+// recently used extracted files to make room if need be. Called with
+// z.rw held.
+func (z *zipFS) makeSpoolRoom(size int64) bool {
+	if size > *spoolMax {
+		return false
+	}
+	for spoolBytes.Add(size) > *spoolMax {
+		spoolBytes.Add(-size)
+		var oldest *zip.File
+		for g, t := range z.spoolUsed {
+			if oldest == nil || t.Before(z.spoolUsed[oldest]) {
+				oldest = g
+			}
+		}
+		if oldest == nil {
+			return false
+		}
+		z.dropSpool(oldest)
+	}
+	return true
+}
+
+// Removes an extracted file. Anyone still reading it has it open, so
+// the space only comes back once they're done. Called with z.rw held.
+func (z *zipFS) dropSpool(f *zip.File) {
+	os.Remove(z.spool[f])
+	delete(z.spool, f)
+	delete(z.spoolUsed, f)
+	// Needs asking for again before it's extracted again
+	delete(z.spoolHits, f)
+	spoolBytes.Add(-int64(f.UncompressedSize64))
+}
+
+// Gets rid of the extracted files once the archive is closed.
+func (z *zipFS) removeSpool() {
+	for f := range z.spool {
+		z.dropSpool(f)
+	}
+}
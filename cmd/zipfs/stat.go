@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jleedev/zipfs"
+)
+
+// What /.zipfs/stat/ says about an entry, without sending its body.
+type StatEntry struct {
+	Name           string    `json:"name"`
+	Size           uint64    `json:"size"`
+	CompressedSize uint64    `json:"compressed_size,omitempty"`
+	Method         string    `json:"method,omitempty"`
+	CRC32          string    `json:"crc32,omitempty"`
+	Modified       time.Time `json:"modified"`
+	Type           string    `json:"type,omitempty"`
+	IsDir          bool      `json:"is_dir"`
+	Encrypted      bool      `json:"encrypted,omitempty"`
+}
+
+func methodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	case 9: // Deflate64, which the package has no name for
+		return "deflate64"
+	case zipfs.Bzip2:
+		return "bzip2"
+	case zipfs.Zstd:
+		return "zstd"
+	case zipfs.AES:
+		return "aes"
+	}
+	return fmt.Sprint(method)
+}
+
+// Describes name, a path under the base directory, if the request is
+// allowed to see it. Directories without entries of their own have
+// their totals from the index.
+func (z *zipFS) Stat(w http.ResponseWriter, r *http.Request, name string) (StatEntry, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	if isControlFile(name) || z.Excluded(name) {
+		http.NotFound(w, r)
+		return StatEntry{}, false
+	}
+	full := path.Join(z.base, name)
+	if !z.Authorize(w, r, full) {
+		return StatEntry{}, false
+	}
+	if d, ok := z.Dir(full); ok {
+		return StatEntry{Name: name, Size: d.Size, Modified: d.Modified, IsDir: true}, true
+	}
+	f := z.Entry(full)
+	if f == nil {
+		http.NotFound(w, r)
+		return StatEntry{}, false
+	}
+	ctype, err := z.MimeType(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return StatEntry{}, false
+	}
+	return StatEntry{
+		Name:           name,
+		Size:           f.UncompressedSize64,
+		CompressedSize: f.CompressedSize64,
+		Method:         methodName(f.Method),
+		CRC32:          fmt.Sprintf("%08x", f.CRC32),
+		Modified:       f.Modified,
+		Type:           ctype,
+		Encrypted:      zipfs.Encrypted(f),
+	}, true
+}
+
+func StatHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		z := a.ForRequest(w, r)
+		if z == nil {
+			return
+		}
+		defer z.Release()
+		e, ok := z.Stat(w, r, r.PathValue("path"))
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(e)
+	})
+}
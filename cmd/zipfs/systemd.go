@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Picks up the sockets systemd passes with socket activation, one for
+// every ListenStream= in the unit, or returns nil if there aren't any.
+// See sd_listen_fds(3).
+func systemdListeners() ([]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("LISTEN_FDS: %w", err)
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// They're meant for this process only
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	lns, err := fileListeners(n)
+	if err != nil {
+		return nil, err
+	}
+	// Sockets with FileDescriptorName=proxy are behind a load balancer
+	// that sends a PROXY protocol header
+	for i := range min(n, len(names)) {
+		if names[i] == "proxy" {
+			lns[i] = ProxyListener{lns[i]}
+		}
+	}
+	return lns, nil
+}
+
+func fileListeners(n int) ([]net.Listener, error) {
+	var lns []net.Listener
+	for fd := 3; fd < 3+n; fd++ {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("listener %d", fd))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+// Sends state to the service manager, if it asked for notifications,
+// and this isn't a worker, which the supervisor speaks for. See
+// sd_notify(3).
+func sdNotify(state string) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" || os.Getenv(workerEnv) != "" {
+		return
+	}
+	// An abstract socket
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		slog.Warn("sd_notify", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Warn("sd_notify", "err", err)
+	}
+}
+
+// How often systemd wants to hear from the process, if WatchdogSec= is
+// set for it. See sd_watchdog_enabled(3).
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Tells systemd the process is ready, and from then on sends it what
+// status says, pinging the watchdog along with it at half the interval
+// it's waiting on. Getting the status takes the same locks requests do,
+// so a process that's stuck stops pinging.
+func NotifySystemd(status func() string) {
+	if os.Getenv("NOTIFY_SOCKET") == "" || os.Getenv(workerEnv) != "" {
+		return
+	}
+	sdNotify("READY=1\nSTATUS=" + status())
+	every, watchdog := statusInterval, watchdogInterval()
+	if watchdog > 0 {
+		every = min(every, watchdog/2)
+	}
+	go func() {
+		for range time.Tick(every) {
+			state := "STATUS=" + status()
+			if watchdog > 0 {
+				state += "\nWATCHDOG=1"
+			}
+			sdNotify(state)
+		}
+	}()
+}
+
+// How often to update the status shown by systemctl status
+const statusInterval = 10 * time.Second
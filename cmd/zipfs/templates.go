@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+var templateDir *string = flag.String("template-dir", "", "directory of templates to use instead of the built in dir.html and landing.html, which are used for any that aren't there")
+
+// Parses the templates in dir, falling back on the embedded ones for
+// any it doesn't have. Other .html files in dir are parsed too, for
+// the ones that replace the defaults to use.
+func LoadTemplates(dir string) (*template.Template, error) {
+	t := template.New("").Funcs(funcs)
+	defaults, err := fs.Glob(static, "template/*")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range defaults {
+		name = path.Base(name)
+		text, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			text, err = static.ReadFile("template/" + name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(name).Parse(string(text)); err != nil {
+			return nil, err
+		}
+	}
+	extra, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range extra {
+		if t.Lookup(filepath.Base(name)) != nil {
+			continue
+		}
+		text, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.New(filepath.Base(name)).Parse(string(text)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var rateLimit *int64 = flag.Int64("rate-limit", 0, "bytes per second to send each response at, or 0 for as fast as possible")
+
+type pathRate struct {
+	pattern string
+	rate    int64
+}
+
+var pathRates []pathRate
+
+func init() {
+	flag.Func("rate-limit-path", "bytes per second for paths matching a pattern, as PATTERN=RATE (repeatable); patterns without a slash match the file name", func(s string) error {
+		pattern, n, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("want PATTERN=RATE")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+		rate, err := strconv.ParseInt(n, 10, 64)
+		if err != nil || rate < 0 {
+			return fmt.Errorf("bad rate %q", n)
+		}
+		pathRates = append(pathRates, pathRate{pattern, rate})
+		return nil
+	})
+}
+
+// The rate for a path, from the first -rate-limit-path that matches or
+// else -rate-limit.
+func RateFor(p string) int64 {
+	for _, pr := range pathRates {
+		name := p
+		if !strings.Contains(pr.pattern, "/") {
+			name = path.Base(p)
+		}
+		if ok, _ := path.Match(pr.pattern, name); ok {
+			return pr.rate
+		}
+	}
+	return *rateLimit
+}
+
+// Paces the response body so that large files can't take all of a
+// small uplink.
+func Throttle(h http.Handler) http.Handler {
+	if *rateLimit == 0 && len(pathRates) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rate := RateFor(r.URL.Path); rate > 0 {
+			w = &throttledWriter{ResponseWriter: w, r: r, rate: rate, start: time.Now()}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	r     *http.Request
+	rate  int64
+	start time.Time
+	sent  int64
+}
+
+// Writes in pieces of a tenth of a second's worth, waiting before each
+// one until the average is back down to the rate.
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(int64(len(p)), max(tw.rate/10, 1))
+		due := tw.start.Add(time.Duration(float64(tw.sent) / float64(tw.rate) * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-tw.r.Context().Done():
+				t.Stop()
+				return written, tw.r.Context().Err()
+			}
+		}
+		m, err := tw.ResponseWriter.Write(p[:n])
+		written += m
+		tw.sent += int64(m)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+var timeout *time.Duration = flag.Duration("timeout", 0, "give up on requests taking longer than this")
+
+// Cuts off requests that are still going after d. The deadline is
+// checked whenever the handler writes, which is constantly while it's
+// copying out a big entry.
+func Timeout(h http.Handler, d time.Duration) http.Handler {
+	if d <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		h.ServeHTTP(&timeoutWriter{ResponseWriter: w, ctx: ctx, d: d}, r.WithContext(ctx))
+	})
+}
+
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	d        time.Duration
+	wrote    bool
+	timedOut bool
+}
+
+// If nothing has been sent yet, the client gets a 503 and can try
+// again. Otherwise all we can do is drop the connection, so that a
+// truncated body doesn't look like a complete one.
+func (tw *timeoutWriter) check() error {
+	err := tw.ctx.Err()
+	if err == nil || tw.timedOut {
+		return err
+	}
+	tw.timedOut = true
+	if tw.wrote {
+		panic(http.ErrAbortHandler)
+	}
+	h := tw.Header()
+	clear(h)
+	msg := "request timed out\n"
+	h.Set("Retry-After", fmt.Sprint(math.Ceil(tw.d.Seconds())))
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("Content-Length", fmt.Sprint(len(msg)))
+	tw.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprint(tw.ResponseWriter, msg)
+	return err
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.check() != nil {
+		return
+	}
+	// Early hints don't count
+	if code >= 200 {
+		tw.wrote = true
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	if err := tw.check(); err != nil {
+		return 0, err
+	}
+	tw.wrote = true
+	return tw.ResponseWriter.Write(p)
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
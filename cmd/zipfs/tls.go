@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var tlsCert *string = flag.String("tls-cert", "", "PEM certificate chain to serve HTTPS with instead of HTTP, along with -tls-key; reread on SIGHUP so a renewed one can be picked up")
+var tlsKey *string = flag.String("tls-key", "", "PEM private key for -tls-cert")
+var autocertCache *string = flag.String("autocert-cache", "", "directory to keep -autocert certificates and the account key in, by default zipfs/autocert under the user's cache directory")
+
+var autocertDomains []string
+
+func init() {
+	flag.Func("autocert", "domain to get a certificate for from Let's Encrypt, accepting its terms, and serve HTTPS with instead of HTTP; the challenge is answered over TLS, so it has to be listening on 443 (repeatable)", func(s string) error {
+		autocertDomains = append(autocertDomains, normalizeHost(s))
+		return nil
+	})
+}
+
+// For serving HTTPS, or nil for plain HTTP.
+var tlsConfig *tls.Config
+
+var tlsKeyPair atomic.Pointer[tls.Certificate]
+
+// Sets up tlsConfig from -tls-cert or -autocert, if either was given.
+func LoadTLS() error {
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return errors.New("-tls-cert and -tls-key go together")
+	}
+	if *tlsCert != "" && len(autocertDomains) > 0 {
+		return errors.New("-tls-cert and -autocert don't go together")
+	}
+	if *tlsCert != "" {
+		if err := loadKeyPair(); err != nil {
+			return err
+		}
+		tlsConfig = &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return tlsKeyPair.Load(), nil
+			},
+		}
+	}
+	if len(autocertDomains) > 0 {
+		dir := *autocertCache
+		if dir == "" {
+			cache, err := os.UserCacheDir()
+			if err != nil {
+				return err
+			}
+			dir = filepath.Join(cache, "zipfs", "autocert")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(dir),
+			HostPolicy: autocert.HostWhitelist(autocertDomains...),
+		}
+		tlsConfig = m.TLSConfig()
+	}
+	return nil
+}
+
+func loadKeyPair() error {
+	cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+	tlsKeyPair.Store(&cert)
+	return nil
+}
+
+// Rereads -tls-cert and -tls-key, keeping the old pair if the new one
+// is no good.
+func reloadKeyPair() {
+	if *tlsCert == "" {
+		return
+	}
+	if err := loadKeyPair(); err != nil {
+		slog.Error("can't reload certificate", "cert", *tlsCert, "err", err)
+	}
+}
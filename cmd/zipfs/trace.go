@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// The distributed trace a request is part of, as told by whatever's in
+// front of the server, so that what's logged about it can be matched up
+// with the rest of the trace.
+type trace struct {
+	id   string
+	span string
+}
+
+type traceKey struct{}
+
+// Reads a W3C traceparent header, or else Zipkin's B3 headers, either
+// the single b3 one or the X-B3- ones.
+func parseTrace(h http.Header) (trace, bool) {
+	if v := h.Get("traceparent"); v != "" {
+		parts := strings.Split(v, "-")
+		if len(parts) >= 4 && len(parts[0]) == 2 && parts[0] != "ff" &&
+			traceHex(parts[1], 32) && traceHex(parts[2], 16) {
+			return trace{parts[1], parts[2]}, true
+		}
+	}
+	if v := h.Get("b3"); v != "" {
+		parts := strings.Split(v, "-")
+		if len(parts) >= 2 && (traceHex(parts[0], 32) || traceHex(parts[0], 16)) && traceHex(parts[1], 16) {
+			return trace{parts[0], parts[1]}, true
+		}
+	}
+	id, span := h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId")
+	if (traceHex(id, 32) || traceHex(id, 16)) && traceHex(span, 16) {
+		return trace{strings.ToLower(id), strings.ToLower(span)}, true
+	}
+	return trace{}, false
+}
+
+// Whether s is an n digit hex ID that isn't all zeros, which is how
+// both formats say there isn't one.
+func traceHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Puts the trace the request is part of, if any, in its context.
+func Trace(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := parseTrace(r.Header); ok {
+			r = r.WithContext(context.WithValue(r.Context(), traceKey{}, t))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// For logging about the request, with the trace it's part of if there
+// is one.
+func requestLog(r *http.Request) *slog.Logger {
+	if t, ok := r.Context().Value(traceKey{}).(trace); ok {
+		return slog.With("trace_id", t.id, "span_id", t.span)
+	}
+	return slog.Default()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+)
+
+// Set for a process started to take over from this one, to an fd it
+// writes to once it's serving.
+const readyFdEnv = "ZIPFS_READY_FD"
+
+// How long a replacement gets to start up
+const handoverTimeout = 30 * time.Second
+
+// How long to let requests finish before exiting anyway
+const drainTimeout = time.Minute
+
+// What's being served, for systemd's status line.
+func archiveStatus() string {
+	archives := servedArchives()
+	for _, a := range archives {
+		a.serving.Done()
+	}
+	return fmt.Sprintf("%d archives open", len(archives))
+}
+
+// Lets whoever started this process know that it's serving now.
+func NotifyReady() {
+	fd, err := strconv.Atoi(os.Getenv(readyFdEnv))
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	f.Write([]byte("ready\n"))
+	f.Close()
+}
+
+// Starts whatever binary is now installed, hands it the listening
+// sockets, and waits for it to say it's serving.
+func Handover(lns []net.Listener) error {
+	files, err := listenerFiles(lns)
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd, err := startChild(files, proxiedListeners(lns), w, false)
+	w.Close()
+	if err != nil {
+		return err
+	}
+	slog.Info("started replacement", "pid", cmd.Process.Pid)
+	r.SetReadDeadline(time.Now().Add(handoverTimeout))
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("replacement didn't start: %w", err)
+	}
+	// It's the one for systemd to watch now
+	sdNotify(fmt.Sprintf("MAINPID=%d", cmd.Process.Pid))
+	// Nobody's going to wait for it but init
+	cmd.Process.Release()
+	return nil
+}
+
+// Serves on the listeners until upgradeSignal comes in, then hands over
+// to a fresh copy of the binary (or, in a worker, leaves that to the
+// supervisor), finishes the requests in progress, and exits. One of
+// stopSignals does the same without a replacement, and reloadSignal
+// reloads without stopping.
+func Serve(lns []net.Listener) {
+	srv := &http.Server{Handler: Restrict(CheckHost(http.DefaultServeMux)), TLSConfig: tlsConfig}
+	errc := make(chan error)
+	for _, ln := range lns {
+		slog.Info("listening on", "listen", ln.Addr(), "tls", tlsConfig != nil)
+		if tlsConfig != nil {
+			go func() { errc <- srv.ServeTLS(ln, "", "") }()
+		} else {
+			go func() { errc <- srv.Serve(ln) }()
+		}
+	}
+	NotifyReady()
+	NotifySystemd(archiveStatus)
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, stopSignals...)
+	for _, sig := range []os.Signal{upgradeSignal, reloadSignal} {
+		if sig != nil {
+			signal.Notify(sigc, sig)
+		}
+	}
+	for {
+		var sig os.Signal
+		select {
+		case err := <-errc:
+			panic(err)
+		case sig = <-sigc:
+		}
+		if sig == reloadSignal {
+			Hangup()
+			continue
+		}
+		if sig == upgradeSignal && os.Getenv(workerEnv) == "" {
+			if err := Handover(lns); err != nil {
+				slog.Error("upgrade", "err", err)
+				continue
+			}
+		} else {
+			sdNotify("STOPPING=1")
+		}
+		break
+	}
+	slog.Info("draining")
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		slog.Error("draining", "err", err)
+	}
+	CloseArchives()
+	os.Exit(0)
+}
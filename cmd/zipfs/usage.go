@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Bytes sent to each user who has logged in through a .zipfsaccess
+// realm, for billing and quotas. Requests nobody had to log in for
+// aren't counted.
+type Usage struct {
+	Requests int64 `json:"requests"`
+	Bytes    int64 `json:"bytes"`
+}
+
+var usage = struct {
+	sync.Mutex
+	m map[string]*Usage
+}{m: make(map[string]*Usage)}
+
+type principalKey struct{}
+
+// Who the request turned out to be from, filled in by CheckAccess.
+type principal struct {
+	sync.Mutex
+	name string
+}
+
+func setPrincipal(r *http.Request, name string) {
+	if p, ok := r.Context().Value(principalKey{}).(*principal); ok {
+		p.Lock()
+		p.name = name
+		p.Unlock()
+	}
+}
+
+// Counts what the handler writes towards whoever it was for.
+func Meter(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &principal{}
+		cw := &countingWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+		p.Lock()
+		name := p.name
+		p.Unlock()
+		if name == "" {
+			return
+		}
+		usage.Lock()
+		u, ok := usage.m[name]
+		if !ok {
+			u = &Usage{}
+			usage.m[name] = u
+		}
+		u.Requests++
+		u.Bytes += cw.n
+		usage.Unlock()
+	})
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (cw *countingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func UsageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		usage.Lock()
+		out := make(map[string]Usage, len(usage.m))
+		for name, u := range usage.m {
+			out[name] = *u
+		}
+		usage.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+}
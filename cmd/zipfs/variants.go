@@ -0,0 +1,39 @@
+package main
+
+import (
+	"archive/zip"
+	"net/http"
+
+	"github.com/jleedev/zipfs"
+)
+
+// Codings an entry can be sent in straight out of the archive, in order
+// of preference.
+var passthroughCodings = []struct {
+	method uint16
+	coding string
+}{
+	{zipfs.Zstd, "zstd"},
+	{zip.Deflate, "gzip"},
+}
+
+// Of the entries in the archive with the same name as f, the one best
+// sent as it is to a client with the request's Accept-Encoding, or f if
+// none of them suits any better.
+func (z *zipFS) Variant(r *http.Request, f *zip.File) *zip.File {
+	variants := z.Variants(f)
+	if variants == nil {
+		return f
+	}
+	for _, c := range passthroughCodings {
+		if !zipfs.AcceptsEncoding(r, c.coding) {
+			continue
+		}
+		for _, v := range variants {
+			if v.Method == c.method && z.Passthrough(v) {
+				return v
+			}
+		}
+	}
+	return f
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/jleedev/zipfs"
+)
+
+var verifyOnOpen *bool = flag.Bool("verify-on-open", false, "check archives for consistency before serving them")
+var verifySample *int = countFlag("verify-sample", 16, "`number` of entries to check the CRC of with -verify-on-open")
+var verifyPassthrough *bool = flag.Bool("verify-passthrough", false, "inflate gzip passthrough responses on the side to check their CRC")
+
+// An int flag that refuses negative numbers.
+type countValue struct{ p *int }
+
+func countFlag(name string, value int, usage string) *int {
+	p := &value
+	flag.Var(countValue{p}, name, usage)
+	return p
+}
+
+func (c countValue) String() string {
+	if c.p == nil {
+		return "0"
+	}
+	return strconv.Itoa(*c.p)
+}
+
+func (c countValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return errors.New("can't be negative")
+	}
+	*c.p = n
+	return nil
+}
+
+// Reads every entry through to the end, which makes archive/zip
+// compare it against the CRC-32 in the central directory.
+func VerifyCRC(files []*zip.File) error {
+	for _, f := range files {
+		// No checking encrypted entries without the password
+		if f.Mode().IsDir() || zipfs.Encrypted(f) {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		_, err = io.Copy(io.Discard, r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Makes sure every entry's local header is where the central directory
+// says, and its data fits inside the file, then checks the CRC of a
+// random sample of entries. Catches truncated or mangled uploads
+// without having to decompress the whole thing.
+func VerifyArchive(z *zip.Reader, size int64) error {
+	for _, f := range z.File {
+		offset, err := f.DataOffset()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		if offset < 0 || uint64(offset)+f.CompressedSize64 > uint64(size) {
+			return fmt.Errorf("%s: data runs past the end of the archive", f.Name)
+		}
+	}
+	sample := z.File
+	if len(sample) > *verifySample {
+		sample = make([]*zip.File, *verifySample)
+		for i, j := range rand.Perm(len(z.File))[:*verifySample] {
+			sample[i] = z.File[j]
+		}
+	}
+	return VerifyCRC(sample)
+}
+
+// Copies the raw deflate data for f to w, while also inflating it to
+// check it against the CRC-32 that's about to go in the gzip trailer.
+func CopyVerified(w io.Writer, raw io.Reader, f *zip.File) error {
+	tee := io.TeeReader(raw, w)
+	h := crc32.NewIEEE()
+	n, err := io.Copy(h, flate.NewReader(tee))
+	if err != nil {
+		return err
+	}
+	// Anything after the end of the deflate stream
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return err
+	}
+	if uint64(n) != f.UncompressedSize64 || h.Sum32() != f.CRC32 {
+		return zip.ErrChecksum
+	}
+	return nil
+}
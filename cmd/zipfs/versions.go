@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+var keepVersions *int = flag.Int("keep-versions", 0, "number of previous archive versions to keep for rollback")
+
+// Requests can ask for a stored version instead of the active one
+const versionHeader = "X-Zipfs-Version"
+const versionParam = "zipfs-version"
+
+// Version names sort in the order they were deployed
+const versionFormat = "20060102T150405.000000000Z"
+
+// Old versions are kept as hard links in a directory next to the
+// archive, and the archive path itself is just another link to
+// whichever version is active.
+func (a *Archive) VersionDir() string {
+	return a.Path + ".versions"
+}
+
+type Version struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Active   bool      `json:"active"`
+}
+
+// Lists the stored versions, oldest first.
+func (a *Archive) Versions() ([]Version, error) {
+	current, err := os.Stat(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(a.VersionDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var versions []Version
+	for _, e := range entries {
+		v, ok := strings.CutSuffix(e.Name(), ".zip")
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, Version{v, info.Size(), info.ModTime(), os.SameFile(info, current)})
+	}
+	return versions, nil
+}
+
+func (a *Archive) versionPath(v string) string {
+	return filepath.Join(a.VersionDir(), v+".zip")
+}
+
+// Moves a freshly uploaded and verified file into place. With
+// versioning on, it becomes the newest version, and whatever was being
+// served before is kept around as well.
+func (a *Archive) Deploy(tmp string, z *zipFS) error {
+	a.deploy.Lock()
+	defer a.deploy.Unlock()
+	if *keepVersions <= 0 {
+		// The open file descriptor follows the rename
+		if err := os.Rename(tmp, a.Path); err != nil {
+			return err
+		}
+		a.Swap(z)
+		return nil
+	}
+	if err := a.recordCurrent(); err != nil {
+		return err
+	}
+	v := time.Now().UTC().Format(versionFormat)
+	if err := os.Rename(tmp, a.versionPath(v)); err != nil {
+		return err
+	}
+	if err := a.link(v); err != nil {
+		return err
+	}
+	a.Swap(z)
+	a.prune()
+	return nil
+}
+
+// Makes sure the archive being served is also in the version
+// directory, so it's possible to roll back to it.
+func (a *Archive) recordCurrent() error {
+	if err := os.MkdirAll(a.VersionDir(), 0o755); err != nil {
+		return err
+	}
+	versions, err := a.Versions()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(versions, func(v Version) bool { return v.Active }) {
+		return nil
+	}
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return err
+	}
+	return os.Link(a.Path, a.versionPath(info.ModTime().UTC().Format(versionFormat)))
+}
+
+// Atomically points the archive path at the given version.
+func (a *Archive) link(v string) error {
+	tmp := fmt.Sprintf("%s.link-%d", a.Path, time.Now().UnixNano())
+	if err := os.Link(a.versionPath(v), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, a.Path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Starts serving a stored version.
+func (a *Archive) Promote(v string) error {
+	a.deploy.Lock()
+	defer a.deploy.Unlock()
+	if v == "" || filepath.Base(v) != v {
+		return fmt.Errorf("bad version %q", v)
+	}
+	z, err := OpenZipFS(a.versionPath(v), a.base)
+	if err != nil {
+		return err
+	}
+	if err := a.link(v); err != nil {
+		z.Release()
+		return err
+	}
+	a.Swap(z)
+	slog.Info("promoted archive version", "name", a.Path, "version", v)
+	return nil
+}
+
+// Goes back to the version deployed before the active one.
+func (a *Archive) Rollback() (string, error) {
+	versions, err := a.Versions()
+	if err != nil {
+		return "", err
+	}
+	i := slices.IndexFunc(versions, func(v Version) bool { return v.Active })
+	if i < 1 {
+		return "", errors.New("no previous version")
+	}
+	v := versions[i-1].Name
+	return v, a.Promote(v)
+}
+
+// Deletes the oldest versions beyond -keep-versions, never the active one.
+func (a *Archive) prune() {
+	versions, err := a.Versions()
+	if err != nil {
+		slog.Warn("listing versions", "err", err)
+		return
+	}
+	for len(versions) > *keepVersions+1 {
+		v := versions[0]
+		versions = versions[1:]
+		if v.Active {
+			continue
+		}
+		slog.Info("pruning archive version", "name", a.Path, "version", v.Name)
+		if err := os.Remove(a.versionPath(v.Name)); err != nil {
+			slog.Warn("pruning version", "err", err)
+		}
+		a.pinMu.Lock()
+		if z, ok := a.pinned[v.Name]; ok {
+			delete(a.pinned, v.Name)
+			z.Release()
+		}
+		a.pinMu.Unlock()
+	}
+}
+
+func RequestedVersion(r *http.Request) string {
+	if v := r.Header.Get(versionHeader); v != "" {
+		return v
+	}
+	return r.URL.Query().Get(versionParam)
+}
+
+// Returns a stored version, opening it if nobody has asked for it
+// yet. It must be released by the caller.
+func (a *Archive) Pinned(v string) (*zipFS, error) {
+	if filepath.Base(v) != v {
+		return nil, os.ErrNotExist
+	}
+	a.pinMu.Lock()
+	defer a.pinMu.Unlock()
+	z, ok := a.pinned[v]
+	if !ok {
+		var err error
+		z, err = OpenZipFS(a.versionPath(v), a.base)
+		if err != nil {
+			return nil, err
+		}
+		a.pinned[v] = z
+	}
+	z.refs.Add(1)
+	return z, nil
+}
+
+func VersionsHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions, err := a.Versions()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+	})
+}
+
+func PromoteHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := r.FormValue("version")
+		if err := a.Promote(v); errors.Is(err, os.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, v)
+		}
+	})
+}
+
+func RollbackHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := a.Rollback()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		fmt.Fprintln(w, v)
+	})
+}
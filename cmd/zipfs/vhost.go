@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var vhosts = make(map[string]string)
+
+func init() {
+	flag.Func("vhost", "HOST=path/to/archive.zip, to serve that archive for requests to HOST, which can be *.example.com for any under it, or * for any host not otherwise named; instead of -name or -root (repeatable)", func(s string) error {
+		host, name, ok := strings.Cut(s, "=")
+		if !ok || host == "" || name == "" {
+			return fmt.Errorf("want HOST=path/to/archive.zip")
+		}
+		host = normalizeHost(host)
+		if _, dup := vhosts[host]; dup {
+			return fmt.Errorf("%s given twice", host)
+		}
+		vhosts[host] = name
+		return nil
+	})
+}
+
+// Serves a different archive for each -vhost, opened the first time
+// it's asked for and kept open the same way as the ones under -root.
+type VirtualHosts struct {
+	*ZipServer
+}
+
+func NewVirtualHosts() *VirtualHosts {
+	return &VirtualHosts{NewZipServer("")}
+}
+
+func (v *VirtualHosts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := matchHost(vhosts, r.Host)
+	if !ok {
+		http.Error(w, "no archive for this host", http.StatusMisdirectedRequest)
+		return
+	}
+	v.mu.Lock()
+	err := v.recentFailure(name)
+	v.mu.Unlock()
+	var a *Archive
+	var hit bool
+	if err == nil {
+		a, hit, err = v.Open(name, requestLog(r))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "can't open archive", http.StatusInternalServerError)
+		return
+	}
+	defer a.serving.Done()
+	CacheStatus(w.Header(), "archive", hit)
+	a.Limit(a.Alarm(Throttle(a))).ServeHTTP(w, r)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var workers *int = flag.Int("workers", 0, "run this many worker processes sharing the listeners")
+
+// Set for processes started with listening sockets, to how many
+// they've been given starting at fd 3.
+const listenFdsEnv = "ZIPFS_LISTEN_FDS"
+
+// Set alongside listenFdsEnv to which of the sockets, counting from 0,
+// expect a PROXY protocol header.
+const proxyFdsEnv = "ZIPFS_PROXY_FDS"
+
+// Set for processes started by a supervisor
+const workerEnv = "ZIPFS_WORKER"
+
+// Gives a worker back the sockets its supervisor opened, or picks up
+// the ones from systemd. Returns nil if there aren't any.
+func InheritedListeners() ([]net.Listener, error) {
+	v := os.Getenv(listenFdsEnv)
+	if v == "" {
+		return systemdListeners()
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", listenFdsEnv, err)
+	}
+	lns, err := fileListeners(n)
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv(proxyFdsEnv); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			i, err := strconv.Atoi(s)
+			if err != nil || i < 0 || i >= n {
+				return nil, fmt.Errorf("%s: bad listener %q", proxyFdsEnv, s)
+			}
+			lns[i] = ProxyListener{lns[i]}
+		}
+	}
+	return lns, nil
+}
+
+// The sockets as files to pass down to a child process.
+func listenerFiles(lns []net.Listener) ([]*os.File, error) {
+	var files []*os.File
+	for _, ln := range lns {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("can't pass on %T", ln)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Which of the listeners expect a PROXY protocol header, for
+// proxyFdsEnv.
+func proxiedListeners(lns []net.Listener) string {
+	var proxied []string
+	for i, ln := range lns {
+		if _, ok := ln.(ProxyListener); ok {
+			proxied = append(proxied, strconv.Itoa(i))
+		}
+	}
+	return strings.Join(proxied, ",")
+}
+
+// Starts the binary with the same arguments, sharing the listening
+// sockets, the proxied ones of which are listed as for proxyFdsEnv. It
+// can report back on ready, if given.
+func startChild(files []*os.File, proxied string, ready *os.File, worker bool) (*exec.Cmd, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	// Still pick up the new binary if the old one was replaced
+	exe = strings.TrimSuffix(exe, " (deleted)")
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", listenFdsEnv, len(files)), proxyFdsEnv+"="+proxied)
+	if ready != nil {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, ready)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", readyFdEnv, 3+len(files)))
+		// It takes over as MAINPID, so the watchdog is its to ping, and
+		// it can't be if this pid is what it sees
+		cmd.Env = slices.DeleteFunc(cmd.Env, func(kv string) bool { return strings.HasPrefix(kv, "WATCHDOG_PID=") })
+	}
+	if worker {
+		cmd.Env = append(cmd.Env, workerEnv+"=1")
+	}
+	return cmd, cmd.Start()
+}
+
+// Keeps n workers running on the listeners, restarting any that die,
+// so one pathological request can only take out its own process. Each
+// worker has its own archive cache, so an upload to one of them only
+// swaps it there. Exits when told to, after passing the signal on.
+//
+// On upgradeSignal the workers are replaced one at a time, each one
+// finishing its requests while the rest keep accepting, and the new
+// ones run whatever binary is installed now. reloadSignal is passed on
+// to all of them at once.
+func Supervise(lns []net.Listener, n int) {
+	files, err := listenerFiles(lns)
+	if err != nil {
+		slog.Error("supervisor", "err", err)
+		os.Exit(1)
+	}
+	proxied := proxiedListeners(lns)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	running := make(map[int]*os.Process)
+	stopping := false
+
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, stopSignals...)
+
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				if stopping {
+					mu.Unlock()
+					return
+				}
+				cmd, err := startChild(files, proxied, nil, true)
+				if err != nil {
+					mu.Unlock()
+					slog.Error("starting worker", "worker", i, "err", err)
+				} else {
+					running[i] = cmd.Process
+					mu.Unlock()
+					slog.Info("started worker", "worker", i, "pid", cmd.Process.Pid)
+					cmd.Wait()
+					if cmd.ProcessState.Success() {
+						// Handed over on purpose
+						continue
+					}
+					slog.Warn("worker exited", "worker", i, "status", cmd.ProcessState)
+				}
+				// Don't spin if it dies straight away
+				time.Sleep(time.Second)
+			}
+		}()
+	}
+
+	for _, sig := range []os.Signal{upgradeSignal, reloadSignal} {
+		if sig != nil {
+			signal.Notify(sigc, sig)
+		}
+	}
+	NotifySystemd(func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return fmt.Sprintf("supervising %d workers", len(running))
+	})
+	var sig os.Signal
+	for sig = range sigc {
+		if sig == reloadSignal {
+			slog.Info("reloading workers")
+			mu.Lock()
+			for _, p := range running {
+				p.Signal(sig)
+			}
+			mu.Unlock()
+			continue
+		}
+		if sig != upgradeSignal {
+			break
+		}
+		slog.Info("replacing workers")
+		for i := range n {
+			mu.Lock()
+			p := running[i]
+			mu.Unlock()
+			if p != nil {
+				p.Signal(sig)
+				time.Sleep(time.Second)
+			}
+		}
+	}
+	slog.Info("stopping workers", "signal", sig)
+	sdNotify("STOPPING=1")
+	mu.Lock()
+	stopping = true
+	for _, p := range running {
+		p.Signal(sig)
+	}
+	mu.Unlock()
+	wg.Wait()
+	os.Exit(0)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/md4"
+)
+
+var zsyncCache *int64 = flag.Int64("zsync-cache", 64<<20, "bytes of memory for keeping generated zsync control files, past which they're made again on each request")
+
+// Memory used by zsync control files across all open archives
+var zsyncBytes atomic.Int64
+
+// Generates a zsync control file, which lets a client that already has
+// an older copy of the file fetch only the blocks that changed, using
+// range requests against url.
+//
+// See http://zsync.moria.org.uk/paper/ for the format. This always
+// writes full length checksums rather than trimming them to the file
+// size the way zsyncmake does, which is allowed but a bit bigger.
+func MakeZsync(r io.Reader, filename, url string, length int64, mtime time.Time) ([]byte, error) {
+	blocksize := 2048
+	if length >= 100_000_000 {
+		blocksize = 4096
+	}
+	seqMatches := 2
+	if length <= int64(blocksize) {
+		seqMatches = 1
+	}
+
+	var sums bytes.Buffer
+	whole := sha1.New()
+	block := make([]byte, blocksize)
+	for {
+		n, err := io.ReadFull(r, block)
+		if n == 0 {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		whole.Write(block[:n])
+		// The final block is padded with zeros
+		clear(block[n:])
+		var a, b uint16
+		for i, c := range block {
+			a += uint16(c)
+			b += uint16(blocksize-i) * uint16(c)
+		}
+		binary.Write(&sums, binary.BigEndian, [2]uint16{a, b})
+		h := md4.New()
+		h.Write(block)
+		sums.Write(h.Sum(nil))
+		if err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "zsync: 0.6.2\n")
+	fmt.Fprintf(&out, "Filename: %s\n", filename)
+	fmt.Fprintf(&out, "MTime: %s\n", mtime.Format(time.RFC1123Z))
+	fmt.Fprintf(&out, "Blocksize: %d\n", blocksize)
+	fmt.Fprintf(&out, "Length: %d\n", length)
+	fmt.Fprintf(&out, "Hash-Lengths: %d,4,16\n", seqMatches)
+	fmt.Fprintf(&out, "URL: %s\n", url)
+	fmt.Fprintf(&out, "SHA-1: %x\n\n", whole.Sum(nil))
+	sums.WriteTo(&out)
+	return out.Bytes(), nil
+}
+
+// Returns the zsync control file for an entry, or for the archive
+// itself if f is nil.
+func (z *zipFS) Zsync(f *zip.File) ([]byte, error) {
+	z.rw.RLock()
+	data, ok := z.zsync[f]
+	z.rw.RUnlock()
+	if ok {
+		return data, nil
+	}
+	if data, ok := z.CacheLoad("zsync", f); ok {
+		z.keepZsync(f, data)
+		return data, nil
+	}
+	if f == nil {
+		var err error
+		data, err = MakeZsync(io.NewSectionReader(z.raw, 0, z.info.Size()), "archive.zip", "archive.zip", z.info.Size(), z.info.ModTime())
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		name := path.Base(f.Name)
+		data, err = MakeZsync(r, name, name, int64(f.UncompressedSize64), f.Modified)
+		if err != nil {
+			return nil, err
+		}
+	}
+	z.CacheStore("zsync", f, data)
+	z.keepZsync(f, data)
+	return data, nil
+}
+
+// Holds on to a control file for as long as the archive is open, if
+// -zsync-cache has room for it.
+func (z *zipFS) keepZsync(f *zip.File, data []byte) {
+	if zsyncBytes.Add(int64(len(data))) > *zsyncCache {
+		// Made again next time, or read back from -cache-dir
+		zsyncBytes.Add(-int64(len(data)))
+		return
+	}
+	z.rw.Lock()
+	defer z.rw.Unlock()
+	if _, ok := z.zsync[f]; ok {
+		// Someone else made it at the same time
+		zsyncBytes.Add(-int64(len(data)))
+		return
+	}
+	z.zsync[f] = data
+	z.zsyncSize += int64(len(data))
+}
+
+func ServeZsync(w http.ResponseWriter, z *zipFS, f *zip.File) {
+	data, err := z.Zsync(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-zsync")
+	w.Write(data)
+}
+
+// Whether the whole archive can be handed out, which it can't if only
+// part of it is being served, or if parts are restricted. Writes an
+// error if not.
+func (z *zipFS) Exposed(w http.ResponseWriter, r *http.Request) bool {
+	if status, realm := z.CheckOuterAccess(r); !z.Permit(w, r, status, realm) {
+		return false
+	}
+	switch {
+	case z.base != "":
+		http.Error(w, "only part of the archive is served", http.StatusForbidden)
+	case len(z.access) > 0:
+		http.Error(w, "archive has access restrictions", http.StatusForbidden)
+	case len(z.settings.Exclude) > 0:
+		http.Error(w, "archive has excluded files", http.StatusForbidden)
+	case len(z.layers) > 0:
+		http.Error(w, "archive is served with overlays on top", http.StatusForbidden)
+	default:
+		return true
+	}
+	return false
+}
+
+// The raw archive, which is what zsync clients make range requests
+// against after reading archive.zip.zsync.
+func RawArchiveHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		z := a.ForRequest(w, r)
+		if z == nil {
+			return
+		}
+		defer z.Release()
+		if !z.Exposed(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		http.ServeContent(w, r, "", z.info.ModTime(), io.NewSectionReader(z.raw, 0, z.info.Size()))
+	})
+}
+
+func ArchiveZsyncHandler(a *Archive) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		z := a.ForRequest(w, r)
+		if z == nil {
+			return
+		}
+		defer z.Release()
+		if !z.Exposed(w, r) {
+			return
+		}
+		ServeZsync(w, z, nil)
+	})
+}
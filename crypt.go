@@ -0,0 +1,266 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted entries use either the original PKWARE cipher, which is
+// weak but still what zip -e does, or WinZip's AES, which shows up as
+// method 99 with the real method in an extra field. archive/zip reads
+// neither, so they're decrypted here given the password.
+const (
+	AES          = 99
+	aesExtraID   = 0x9901
+	aesMACLen    = 10
+	pkwareHdrLen = 12
+)
+
+var ErrPassword = errors.New("zipfs: wrong or missing password")
+
+// Whether the entry needs a password to read.
+func Encrypted(f *zip.File) bool {
+	return f.Flags&0x1 != 0
+}
+
+// The password the client sent for encrypted entries, in an
+// X-Zip-Password header or as the basic auth password.
+func Password(r *http.Request) string {
+	if p := r.Header.Get("X-Zip-Password"); p != "" {
+		return p
+	}
+	_, p, _ := r.BasicAuth()
+	return p
+}
+
+// Opens an encrypted entry with the password, returning ErrPassword if
+// it's the wrong one. The data is checked against the CRC-32 or the
+// AES authentication code as it's read, so a password that gets past
+// the quick check at the start but is still wrong, which happens to
+// one in 256 with the PKWARE cipher, ends in zip.ErrChecksum.
+func (z *FS) Decrypt(f *zip.File, password string) (io.ReadCloser, error) {
+	raw, err := z.RawSeeker(f)
+	if err != nil {
+		return nil, err
+	}
+	if f.Method == AES {
+		return decryptAES(f, raw, password)
+	}
+	return decryptPKWARE(f, raw, password)
+}
+
+// Like Decrypt, but for ServeContent, in the same way as OpenSeeker.
+func (z *FS) DecryptSeeker(f *zip.File, password string) (io.ReadSeekCloser, error) {
+	r, err := z.Decrypt(f, password)
+	if err != nil {
+		return nil, err
+	}
+	open := func() (io.ReadCloser, error) { return z.Decrypt(f, password) }
+	return &inflateSeeker{open: open, r: r, size: int64(f.UncompressedSize64)}, nil
+}
+
+func decryptPKWARE(f *zip.File, raw io.Reader, password string) (io.ReadCloser, error) {
+	k := pkwareKeys{0x12345678, 0x23456789, 0x34567890}
+	for _, c := range []byte(password) {
+		k.update(c)
+	}
+	var hdr [pkwareHdrLen]byte
+	if _, err := io.ReadFull(raw, hdr[:]); err != nil {
+		return nil, err
+	}
+	k.decrypt(hdr[:])
+	// The last byte of the header is the top of the CRC, or of the
+	// time if the CRC wasn't known when the header was written
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if hdr[pkwareHdrLen-1] != check {
+		return nil, ErrPassword
+	}
+	rc, err := decompress(f.Method, &pkwareReader{raw, &k})
+	if err != nil {
+		return nil, err
+	}
+	return &checksumReader{rc: rc, f: f, hash: crc32.NewIEEE()}, nil
+}
+
+type pkwareKeys [3]uint32
+
+func (k *pkwareKeys) update(c byte) {
+	k[0] = crc32Update(k[0], c)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+func (k *pkwareKeys) decrypt(b []byte) {
+	for i, c := range b {
+		t := uint16(k[2] | 2)
+		c ^= byte(t * (t ^ 1) >> 8)
+		k.update(c)
+		b[i] = c
+	}
+}
+
+func crc32Update(crc uint32, c byte) uint32 {
+	return crc32.IEEETable[byte(crc)^c] ^ crc>>8
+}
+
+type pkwareReader struct {
+	r io.Reader
+	k *pkwareKeys
+}
+
+func (p *pkwareReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.k.decrypt(b[:n])
+	return n, err
+}
+
+func decryptAES(f *zip.File, raw io.ReadSeeker, password string) (io.ReadCloser, error) {
+	version, strength, method, ok := aesExtra(f.Extra)
+	if !ok || strength < 1 || strength > 3 {
+		return nil, zip.ErrAlgorithm
+	}
+	keyLen, saltLen := 8+8*int(strength), 4+4*int(strength)
+	head := make([]byte, saltLen+2)
+	if _, err := io.ReadFull(raw, head); err != nil {
+		return nil, err
+	}
+	key := pbkdf2.Key([]byte(password), head[:saltLen], 1000, 2*keyLen+2, sha1.New)
+	if subtle.ConstantTimeCompare(key[2*keyLen:], head[saltLen:]) != 1 {
+		return nil, ErrPassword
+	}
+	block, err := aes.NewCipher(key[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+	size := int64(f.CompressedSize64) - int64(len(head)) - aesMACLen
+	if size < 0 {
+		return nil, zip.ErrFormat
+	}
+	ar := &aesReader{
+		r:     io.LimitReader(raw, size),
+		trail: raw,
+		block: block,
+		mac:   hmac.New(sha1.New, key[keyLen:2*keyLen]),
+	}
+	rc, err := decompress(method, ar)
+	if err != nil {
+		return nil, err
+	}
+	// AE-2 leaves the CRC out, the authentication code being enough
+	cr := &checksumReader{rc: rc, f: f, rest: ar}
+	if version == 1 {
+		cr.hash = crc32.NewIEEE()
+	}
+	return cr, nil
+}
+
+// Reads the AES extra field: AE-1 or AE-2, the key size, and the
+// compression method.
+func aesExtra(extra []byte) (version uint16, strength byte, method uint16, ok bool) {
+	le := binary.LittleEndian
+	for len(extra) >= 4 {
+		id, n := le.Uint16(extra), int(le.Uint16(extra[2:]))
+		if len(extra) < 4+n {
+			break
+		}
+		if d := extra[4 : 4+n]; id == aesExtraID && n >= 7 && string(d[2:4]) == "AE" {
+			return le.Uint16(d), d[4], le.Uint16(d[5:]), true
+		}
+		extra = extra[4+n:]
+	}
+	return 0, 0, 0, false
+}
+
+// AES in counter mode, with the counter little endian and starting at
+// one, and an HMAC-SHA1 of the encrypted data checked at the end.
+type aesReader struct {
+	r, trail io.Reader
+	block    cipher.Block
+	mac      hash.Hash
+	counter  uint64
+	stream   [aes.BlockSize]byte
+	used     int
+	checked  bool
+}
+
+func (a *aesReader) Read(b []byte) (int, error) {
+	n, err := a.r.Read(b)
+	a.mac.Write(b[:n])
+	for i := range b[:n] {
+		if a.used == 0 || a.used == aes.BlockSize {
+			a.counter++
+			var ctr [aes.BlockSize]byte
+			binary.LittleEndian.PutUint64(ctr[:], a.counter)
+			a.block.Encrypt(a.stream[:], ctr[:])
+			a.used = 0
+		}
+		b[i] ^= a.stream[a.used]
+		a.used++
+	}
+	if err == io.EOF && !a.checked {
+		a.checked = true
+		var want [aesMACLen]byte
+		if _, err := io.ReadFull(a.trail, want[:]); err != nil {
+			return n, err
+		}
+		if !hmac.Equal(a.mac.Sum(nil)[:aesMACLen], want[:]) {
+			return n, zip.ErrChecksum
+		}
+	}
+	return n, err
+}
+
+func decompress(method uint16, r io.Reader) (io.ReadCloser, error) {
+	d, ok := decompressors[method]
+	if !ok {
+		return nil, zip.ErrAlgorithm
+	}
+	return d(r), nil
+}
+
+// Checks the size, and the CRC-32 if hash is set, at the end.
+type checksumReader struct {
+	rc   io.ReadCloser
+	f    *zip.File
+	hash hash.Hash32
+	n    uint64
+	// Read to the end too, for the authentication code, even if the
+	// compressed data ended before it
+	rest io.Reader
+}
+
+func (c *checksumReader) Read(b []byte) (int, error) {
+	n, err := c.rc.Read(b)
+	c.n += uint64(n)
+	if c.hash != nil {
+		c.hash.Write(b[:n])
+	}
+	if err == io.EOF {
+		if c.n != c.f.UncompressedSize64 || c.hash != nil && c.hash.Sum32() != c.f.CRC32 {
+			return n, zip.ErrChecksum
+		}
+		if c.rest != nil {
+			if _, err := io.Copy(io.Discard, c.rest); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, err
+}
+
+func (c *checksumReader) Close() error { return c.rc.Close() }
@@ -0,0 +1,170 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// Both fixtures have the same two files with the password "secret".
+// zipcrypto.zip is from Info-ZIP's zip -e: fox.txt stored, numbers.txt
+// deflated. In aes.zip, fox.txt is AE-1 with AES-128, stored, and
+// numbers.txt is AE-2 with AES-256, deflated.
+var cryptWant = map[string]string{
+	"fox.txt":     "The quick brown fox jumps over the lazy dog.\n",
+	"numbers.txt": numbers(400),
+}
+
+func numbers(n int) string {
+	var b bytes.Buffer
+	for i := 1; i <= n; i++ {
+		fmt.Fprintln(&b, i)
+	}
+	return b.String()
+}
+
+func openFixture(t *testing.T, name string) (*FS, []byte) {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := New(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z, data
+}
+
+func TestDecrypt(t *testing.T) {
+	for _, fixture := range []string{"zipcrypto.zip", "aes.zip"} {
+		z, _ := openFixture(t, fixture)
+		for name, want := range cryptWant {
+			t.Run(fixture+"/"+name, func(t *testing.T) {
+				f := z.Entry(name)
+				if f == nil {
+					t.Fatal("missing")
+				}
+				if !Encrypted(f) {
+					t.Fatal("not encrypted")
+				}
+				rc, err := z.Decrypt(f, "secret")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer rc.Close()
+				got, err := io.ReadAll(rc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestDecryptSeeker(t *testing.T) {
+	z, _ := openFixture(t, "aes.zip")
+	rs, err := z.DecryptSeeker(z.Entry("numbers.txt"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+	if _, err := rs.Seek(1000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := cryptWant["numbers.txt"][1000:]; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecryptWrongPassword(t *testing.T) {
+	for _, fixture := range []string{"zipcrypto.zip", "aes.zip"} {
+		z, _ := openFixture(t, fixture)
+		for name := range cryptWant {
+			_, err := z.Decrypt(z.Entry(name), "hunter2")
+			if !errors.Is(err, ErrPassword) {
+				t.Errorf("%s/%s: got %v, want ErrPassword", fixture, name, err)
+			}
+		}
+	}
+}
+
+// A flipped bit in the data gets past the password check but not the
+// CRC or the authentication code.
+func TestDecryptCorrupt(t *testing.T) {
+	for _, fixture := range []string{"zipcrypto.zip", "aes.zip"} {
+		for name := range cryptWant {
+			t.Run(fixture+"/"+name, func(t *testing.T) {
+				z, data := openFixture(t, fixture)
+				f := z.Entry(name)
+				off, err := f.DataOffset()
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Past the 12 byte PKWARE header, or the AES salt and
+				// verifier
+				data = bytes.Clone(data)
+				data[off+20] ^= 1
+				z, err = New(bytes.NewReader(data), int64(len(data)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				rc, err := z.Decrypt(z.Entry(name), "secret")
+				if err == nil {
+					defer rc.Close()
+					_, err = io.ReadAll(rc)
+				}
+				if err == nil {
+					t.Fatal("no error")
+				}
+				if errors.Is(err, ErrPassword) {
+					t.Errorf("got %v, want a checksum or data error", err)
+				}
+			})
+		}
+	}
+}
+
+func TestAESExtra(t *testing.T) {
+	z, _ := openFixture(t, "aes.zip")
+	for name, want := range map[string][3]int{
+		"fox.txt":     {1, 1, int(zip.Store)},
+		"numbers.txt": {2, 3, int(zip.Deflate)},
+	} {
+		f := z.Entry(name)
+		if f.Method != AES {
+			t.Errorf("%s: method %d", name, f.Method)
+		}
+		version, strength, method, ok := aesExtra(f.Extra)
+		if got := [3]int{int(version), int(strength), int(method)}; !ok || got != want {
+			t.Errorf("%s: got %v, %v, want %v", name, got, ok, want)
+		}
+	}
+	if _, _, _, ok := aesExtra([]byte{0x01, 0x99, 0xff, 0x00}); ok {
+		t.Error("truncated extra field accepted")
+	}
+}
+
+func TestPassword(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("alice", "from-auth")
+	if got := Password(r); got != "from-auth" {
+		t.Errorf("got %q", got)
+	}
+	r.Header.Set("X-Zip-Password", "from-header")
+	if got := Password(r); got != "from-header" {
+		t.Errorf("got %q", got)
+	}
+}
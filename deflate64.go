@@ -0,0 +1,381 @@
+package zipfs
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Deflate64 is what Windows Explorer uses for large files. It's
+// deflate with a 64K window, distance codes 30 and 31 switched on, and
+// length code 285 taking 16 extra bits instead of always meaning 258.
+// Nothing in the standard library reads it, hence this inflater, which
+// is written for being obviously correct rather than fast.
+const zipDeflate64 = 9
+
+var errDeflate64 = errors.New("deflate64: corrupt input")
+
+func NewDeflate64Reader(r io.Reader) io.ReadCloser {
+	return &inflater{r: bufio.NewReader(r), deflate64: true}
+}
+
+var lengthBase = [29]uint16{
+	3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+	35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+var lengthExtra = [29]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+	3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+var distBase = [32]uint32{
+	1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+	257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145,
+	8193, 12289, 16385, 24577, 32769, 49153}
+var distExtra = [32]uint8{
+	0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+	7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13, 14, 14}
+
+// Order in which the code length code lengths are sent
+var codeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+const windowSize = 1 << 16
+
+type inflater struct {
+	r         *bufio.Reader
+	deflate64 bool
+	bits      uint32
+	nbits     uint
+	err       error
+
+	window  [windowSize]byte
+	pos     int   // next write position in window
+	written int64 // total output so far
+
+	final    bool     // this is the last block
+	stored   int      // bytes left in a stored block
+	lit      *huffman // literal/length code, nil between blocks
+	dist     *huffman
+	copyLen  int // a match still being copied out
+	copyDist int
+}
+
+// A canonical Huffman code as a lookup table indexed by the next
+// maxLen bits of input, with each entry being symbol<<4 | length.
+type huffman struct {
+	table  []uint16
+	maxLen uint
+}
+
+func newHuffman(lengths []uint8) (*huffman, error) {
+	var count [16]int
+	var maxLen uint8
+	for _, l := range lengths {
+		count[l]++
+		maxLen = max(maxLen, l)
+	}
+	count[0] = 0
+	var next [16]int
+	code := 0
+	for n := 1; n < 16; n++ {
+		code = (code + count[n-1]) << 1
+		next[n] = code
+	}
+	h := &huffman{table: make([]uint16, 1<<maxLen), maxLen: uint(maxLen)}
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		if c >= 1<<l {
+			return nil, errDeflate64
+		}
+		// Codes are sent most significant bit first
+		rev := int(bits.Reverse16(uint16(c)) >> (16 - l))
+		for i := rev; i < len(h.table); i += 1 << l {
+			h.table[i] = uint16(sym)<<4 | uint16(l)
+		}
+	}
+	return h, nil
+}
+
+var fixedLit, fixedDist *huffman
+
+func init() {
+	var lengths [288]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	fixedLit, _ = newHuffman(lengths[:])
+	var dist [32]uint8
+	for i := range dist {
+		dist[i] = 5
+	}
+	fixedDist, _ = newHuffman(dist[:])
+}
+
+// Tries to have at least n bits buffered.
+func (f *inflater) fill(n uint) bool {
+	for f.nbits < n {
+		b, err := f.r.ReadByte()
+		if err != nil {
+			return false
+		}
+		f.bits |= uint32(b) << f.nbits
+		f.nbits += 8
+	}
+	return true
+}
+
+func (f *inflater) readBits(n uint) (int, error) {
+	if !f.fill(n) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := f.bits & (1<<n - 1)
+	f.bits >>= n
+	f.nbits -= n
+	return int(v), nil
+}
+
+func (f *inflater) decode(h *huffman) (int, error) {
+	if len(h.table) <= 1 {
+		return 0, errDeflate64
+	}
+	// Near the end of the stream there may be fewer than maxLen bits
+	// left, which is fine as long as the code itself is shorter
+	f.fill(h.maxLen)
+	e := h.table[f.bits&(1<<h.maxLen-1)]
+	n := uint(e & 15)
+	if e == 0 {
+		return 0, errDeflate64
+	}
+	if n > f.nbits {
+		return 0, io.ErrUnexpectedEOF
+	}
+	f.bits >>= n
+	f.nbits -= n
+	return int(e >> 4), nil
+}
+
+func (f *inflater) nextBlock() error {
+	if f.final {
+		return io.EOF
+	}
+	header, err := f.readBits(3)
+	if err != nil {
+		return err
+	}
+	f.final = header&1 == 1
+	switch header >> 1 {
+	case 0:
+		// Stored blocks start on a byte boundary
+		f.bits >>= f.nbits % 8
+		f.nbits -= f.nbits % 8
+		n, err := f.readBits(16)
+		if err != nil {
+			return err
+		}
+		nn, err := f.readBits(16)
+		if err != nil {
+			return err
+		}
+		if n != ^nn&0xffff {
+			return errDeflate64
+		}
+		f.stored = n
+	case 1:
+		f.lit, f.dist = fixedLit, fixedDist
+	case 2:
+		return f.readDynamic()
+	default:
+		return errDeflate64
+	}
+	return nil
+}
+
+func (f *inflater) readDynamic() error {
+	var hlit, hdist, hclen int
+	var err error
+	if hlit, err = f.readBits(5); err != nil {
+		return err
+	}
+	if hdist, err = f.readBits(5); err != nil {
+		return err
+	}
+	if hclen, err = f.readBits(4); err != nil {
+		return err
+	}
+	hlit += 257
+	hdist += 1
+	hclen += 4
+
+	var clen [19]uint8
+	for _, i := range codeLengthOrder[:hclen] {
+		n, err := f.readBits(3)
+		if err != nil {
+			return err
+		}
+		clen[i] = uint8(n)
+	}
+	ch, err := newHuffman(clen[:])
+	if err != nil {
+		return err
+	}
+
+	lengths := make([]uint8, hlit+hdist)
+	for i := 0; i < len(lengths); {
+		sym, err := f.decode(ch)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+		var rep int
+		var val uint8
+		switch sym {
+		case 16:
+			if i == 0 {
+				return errDeflate64
+			}
+			val = lengths[i-1]
+			rep, err = f.readBits(2)
+			rep += 3
+		case 17:
+			rep, err = f.readBits(3)
+			rep += 3
+		default:
+			rep, err = f.readBits(7)
+			rep += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+rep > len(lengths) {
+			return errDeflate64
+		}
+		for ; rep > 0; rep-- {
+			lengths[i] = val
+			i++
+		}
+	}
+	if lengths[256] == 0 {
+		return errDeflate64
+	}
+	if f.lit, err = newHuffman(lengths[:hlit]); err != nil {
+		return err
+	}
+	if f.dist, err = newHuffman(lengths[hlit:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f *inflater) put(b byte) {
+	f.window[f.pos] = b
+	f.pos = (f.pos + 1) % windowSize
+	f.written++
+}
+
+func (f *inflater) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && f.err == nil {
+		switch {
+		case f.copyLen > 0:
+			b := f.window[(f.pos-f.copyDist+windowSize)%windowSize]
+			f.put(b)
+			p[n] = b
+			n++
+			f.copyLen--
+		case f.stored > 0:
+			var b byte
+			if f.nbits > 0 {
+				b = byte(f.bits)
+				f.bits >>= 8
+				f.nbits -= 8
+			} else if b, f.err = f.r.ReadByte(); f.err == io.EOF {
+				f.err = io.ErrUnexpectedEOF
+				break
+			} else if f.err != nil {
+				break
+			}
+			f.put(b)
+			p[n] = b
+			n++
+			f.stored--
+		case f.lit == nil:
+			f.err = f.nextBlock()
+		default:
+			f.err = f.symbol(p, &n)
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, f.err
+}
+
+// Decodes one literal, match, or end of block.
+func (f *inflater) symbol(p []byte, n *int) error {
+	sym, err := f.decode(f.lit)
+	if err != nil {
+		return err
+	}
+	switch {
+	case sym < 256:
+		f.put(byte(sym))
+		p[*n] = byte(sym)
+		*n++
+		return nil
+	case sym == 256:
+		f.lit, f.dist = nil, nil
+		return nil
+	case sym > 285:
+		return errDeflate64
+	}
+	sym -= 257
+	length, extra := int(lengthBase[sym]), uint(lengthExtra[sym])
+	if sym == 28 && f.deflate64 {
+		length, extra = 3, 16
+	}
+	e, err := f.readBits(extra)
+	if err != nil {
+		return err
+	}
+	length += e
+
+	dsym, err := f.decode(f.dist)
+	if err != nil {
+		return err
+	}
+	if dsym >= 30 && !f.deflate64 {
+		return errDeflate64
+	}
+	e, err = f.readBits(uint(distExtra[dsym]))
+	if err != nil {
+		return err
+	}
+	dist := int(distBase[dsym]) + e
+	if int64(dist) > f.written || dist > windowSize {
+		return errDeflate64
+	}
+	f.copyLen, f.copyDist = length, dist
+	return nil
+}
+
+func (f *inflater) Close() error {
+	if f.err == nil || f.err == io.EOF {
+		return nil
+	}
+	return f.err
+}
@@ -0,0 +1,214 @@
+package zipfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// Writes deflate streams by hand, least significant bit first, the way
+// the format packs them.
+type bitWriter struct {
+	buf   bytes.Buffer
+	bits  uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(v int, n uint) {
+	w.bits |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf.WriteByte(byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+// Huffman codes go most significant bit first.
+func (w *bitWriter) code(c int, n uint) {
+	w.write(int(bits.Reverse16(uint16(c))>>(16-n)), n)
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.write(0, 8-w.nbits)
+	}
+	return w.buf.Bytes()
+}
+
+func (w *bitWriter) stored(final bool, data []byte) {
+	w.header(final, 0)
+	w.flush()
+	w.write(len(data), 16)
+	w.write(^len(data)&0xffff, 16)
+	w.buf.Write(data)
+}
+
+func (w *bitWriter) header(final bool, kind int) {
+	f := 0
+	if final {
+		f = 1
+	}
+	w.write(f|kind<<1, 3)
+}
+
+// A symbol from the fixed literal/length code.
+func (w *bitWriter) fixedLit(sym int) {
+	switch {
+	case sym < 144:
+		w.code(0x30+sym, 8)
+	case sym < 256:
+		w.code(0x190+sym-144, 9)
+	case sym < 280:
+		w.code(sym-256, 7)
+	default:
+		w.code(0xc0+sym-280, 8)
+	}
+}
+
+// A match in a fixed block, given by its codes and extra bits.
+func (w *bitWriter) match(lenSym, lenExtra int, lenBits uint, distSym, distExtra int, distBits uint) {
+	w.fixedLit(lenSym)
+	w.write(lenExtra, lenBits)
+	w.code(distSym, 5)
+	w.write(distExtra, distBits)
+}
+
+func inflate64(data []byte, deflate64 bool) ([]byte, error) {
+	f := &inflater{r: bufio.NewReader(bytes.NewReader(data)), deflate64: deflate64}
+	return io.ReadAll(f)
+}
+
+func TestDeflate64(t *testing.T) {
+	random := make([]byte, 40000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	var far bitWriter
+	far.stored(false, random)
+	far.header(true, 1)
+	// Distance code 30 is 32769 plus 14 bits, so this is 40000 back, to
+	// the start; length code 285 is 3 plus 16 bits
+	far.match(285, 1000-3, 16, 30, 40000-32769, 14)
+	far.fixedLit(256)
+
+	var long bitWriter
+	long.header(true, 1)
+	long.fixedLit('a')
+	long.match(285, 65535, 16, 0, 0, 0)
+	long.fixedLit(256)
+
+	var lit bitWriter
+	lit.header(true, 1)
+	for _, c := range []byte("hello, deflate64") {
+		lit.fixedLit(int(c))
+	}
+	lit.fixedLit(256)
+
+	var short bitWriter
+	short.stored(true, []byte("stored"))
+
+	for _, tt := range []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"stored", short.flush(), []byte("stored")},
+		{"literals", lit.flush(), []byte("hello, deflate64")},
+		{"beyond 32K", far.flush(), append(bytes.Clone(random), random[:1000]...)},
+		{"longer than 258", long.flush(), bytes.Repeat([]byte("a"), 65539)},
+	} {
+		got, err := io.ReadAll(NewDeflate64Reader(bytes.NewReader(tt.in)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %d bytes, want %d", tt.name, len(got), len(tt.want))
+		}
+	}
+}
+
+func TestDeflate64Truncated(t *testing.T) {
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(2)).Read(random)
+	var w bitWriter
+	w.stored(false, random)
+	w.header(true, 1)
+	w.match(285, 100, 16, 9, 0, 3)
+	w.fixedLit(256)
+	full := w.flush()
+	if _, err := io.ReadAll(NewDeflate64Reader(bytes.NewReader(full))); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 3, 500, len(full) - 4, len(full) - 1} {
+		_, err := io.ReadAll(NewDeflate64Reader(bytes.NewReader(full[:n])))
+		if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, errDeflate64) {
+			t.Errorf("cut to %d bytes: got %v", n, err)
+		}
+	}
+}
+
+func TestDeflate64Corrupt(t *testing.T) {
+	var behind bitWriter
+	behind.header(true, 1)
+	behind.fixedLit('a')
+	// Two back, with only one byte written
+	behind.match(257, 0, 0, 1, 0, 0)
+	behind.fixedLit(256)
+
+	var badType bitWriter
+	badType.header(true, 3)
+
+	var badStored bitWriter
+	badStored.header(true, 0)
+	badStored.flush()
+	badStored.write(5, 16)
+	badStored.write(5, 16)
+
+	for name, in := range map[string][]byte{
+		"distance too far": behind.flush(),
+		"block type 3":     badType.flush(),
+		"stored length":    badStored.flush(),
+	} {
+		if _, err := io.ReadAll(NewDeflate64Reader(bytes.NewReader(in))); !errors.Is(err, errDeflate64) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+}
+
+// Plain deflate, from compress/flate with its dynamic codes, comes out
+// the same, and the deflate64 codes are refused in it.
+func TestInflatePlain(t *testing.T) {
+	var want bytes.Buffer
+	for i := range 5000 {
+		want.WriteString("line ")
+		want.WriteByte(byte('a' + i%26))
+		want.WriteString(" of the test data\n")
+	}
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	fw.Write(want.Bytes())
+	fw.Close()
+	got, err := inflate64(buf.Bytes(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("got %d bytes, want %d", len(got), want.Len())
+	}
+
+	random := make([]byte, 40000)
+	var far bitWriter
+	far.stored(false, random)
+	far.header(true, 1)
+	far.match(257, 0, 0, 30, 0, 14)
+	far.fixedLit(256)
+	if _, err := inflate64(far.flush(), false); !errors.Is(err, errDeflate64) {
+		t.Errorf("distance code 30 in plain deflate: got %v", err)
+	}
+}
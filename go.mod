@@ -1,3 +1,16 @@
 module github.com/jleedev/zipfs
 
-go 1.23
+go 1.23.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/andybalholm/brotli v1.2.5
+	github.com/klauspost/compress v1.17.11
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.38.0
+	golang.org/x/sync v0.12.0
+	golang.org/x/sys v0.31.0
+)
+
+require golang.org/x/text v0.23.0 // indirect
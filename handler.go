@@ -0,0 +1,158 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Serves the files in z, with directories served by their index.html.
+// Deflated entries go to clients that take gzip as they are in the
+// archive, and to everyone else inflated, with ranges.
+func Handler(z *FS) http.Handler {
+	return handler{z}
+}
+
+type handler struct{ z *FS }
+
+func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The URL always starts with a /, but fs.FS doesn't want that
+	name := strings.Trim(r.URL.Path, "/")
+	if name == "" {
+		name = "."
+	}
+	entry, err := h.z.Find(name)
+	if err == nil {
+		if _, ok := entry.File.(fs.ReadDirFile); ok {
+			entry.Close()
+			if !strings.HasSuffix(r.URL.Path, "/") {
+				// To what the client asked for, with any prefix still on it
+				u, err := url.ParseRequestURI(r.RequestURI)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				u.Path, u.RawPath = u.Path+"/", u.EscapedPath()+"/"
+				http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+				return
+			}
+			entry, err = h.z.Find(path.Join(name, "index.html"))
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer entry.Close()
+	f := entry.Entry
+	if Encrypted(f) {
+		rs, err := h.z.DecryptSeeker(f, Password(r))
+		if errors.Is(err, ErrPassword) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="zipfs"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rs.Close()
+		if ctype, ok := TypeByName(f.Name); ok {
+			w.Header().Set("Content-Type", ctype)
+		}
+		w.Header().Set("Cache-Control", "private")
+		http.ServeContent(w, r, path.Base(f.Name), f.Modified, rs)
+		return
+	}
+	ctype, err := h.z.MimeType(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ctype)
+	if f.Method == zip.Deflate || f.Method == Zstd {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if f.Method == Zstd && r.Header.Get("Range") == "" && AcceptsEncoding(r, "zstd") {
+		// A zstd entry is a zstd frame as it is
+		src, err := h.z.RawSeeker(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Encoding", "zstd")
+		http.ServeContent(w, r, "", f.Modified, src)
+		return
+	}
+	// Ranges are of the uncompressed file
+	if f.Method == zip.Deflate && r.Header.Get("Range") == "" && AcceptsEncoding(r, "gzip") {
+		w.Header().Set("Last-Modified", f.Modified.UTC().Format(http.TimeFormat))
+		if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !f.Modified.Truncate(1e9).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		src, err := f.OpenRaw()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.FormatUint(GzipSize(f), 10))
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(GzipHeader(f))
+		io.Copy(w, src)
+		w.Write(GzipTrailer(f))
+		return
+	}
+	rs, err := h.z.OpenSeeker(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rs.Close()
+	http.ServeContent(w, r, "", f.Modified, rs)
+}
+
+// Whether the client takes the content coding, and hasn't said q=0.
+func AcceptsEncoding(r *http.Request, coding string) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), coding) {
+				continue
+			}
+			q, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(params), "q="), 64)
+			return err != nil || q > 0
+		}
+	}
+	return false
+}
+
+// A deflated entry makes a gzip file with its raw data between
+// GzipHeader and GzipTrailer, GzipSize bytes in all.
+func GzipSize(f *zip.File) uint64 {
+	return f.CompressedSize64 + 18
+}
+
+func GzipHeader(f *zip.File) []byte {
+	b := []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff")
+	binary.LittleEndian.PutUint32(b[4:], uint32(f.Modified.Unix()))
+	return b
+}
+
+func GzipTrailer(f *zip.File) []byte {
+	return binary.LittleEndian.AppendUint32(
+		binary.LittleEndian.AppendUint32(nil, f.CRC32),
+		uint32(f.UncompressedSize64%0x1_0000_0000))
+}
@@ -0,0 +1,125 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// What's known about a directory, whether or not the archive has an
+// entry for it, gathered in one pass over the central directory.
+type DirInfo struct {
+	// The newest entry anywhere inside
+	Modified time.Time
+	// Entries directly inside
+	Count int
+	// Uncompressed size of everything inside
+	Size uint64
+	// Names of what's directly inside, sorted, so it can be listed
+	// without ReadDir putting together an fs.DirEntry for each
+	Names []string
+}
+
+// Indexes every directory by its name as fs.FS would have it, with
+// "." being the root of the archive.
+func indexDirs(files []*zip.File) map[string]*DirInfo {
+	dirs := map[string]*DirInfo{".": {}}
+	// Finds a directory, creating it and its parents as needed
+	var lookup func(name string) *DirInfo
+	lookup = func(name string) *DirInfo {
+		d, ok := dirs[name]
+		if !ok {
+			d = &DirInfo{}
+			dirs[name] = d
+			parent := lookup(path.Dir(name))
+			parent.Count++
+			parent.Names = append(parent.Names, path.Base(name))
+		}
+		return d
+	}
+	listed := make(map[string]bool)
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name, "/")
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		isDir := strings.HasSuffix(f.Name, "/")
+		if isDir {
+			lookup(name)
+		} else {
+			// Another copy of a file already counted
+			if listed[name] {
+				continue
+			}
+			listed[name] = true
+			parent := lookup(path.Dir(name))
+			parent.Count++
+			if _, isDir := dirs[name]; !isDir {
+				parent.Names = append(parent.Names, path.Base(name))
+			}
+		}
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			d := dirs[dir]
+			if f.Modified.After(d.Modified) {
+				d.Modified = f.Modified
+			}
+			if !isDir {
+				d.Size += f.UncompressedSize64
+			}
+			if dir == "." {
+				break
+			}
+		}
+	}
+	for _, d := range dirs {
+		slices.Sort(d.Names)
+	}
+	return dirs
+}
+
+// Indexes every entry by its name as fs.FS would have it, directories
+// without their trailing slash. Like zip.Reader.Open, the first of any
+// entries with the same name wins.
+func indexFiles(files []*zip.File) map[string]*zip.File {
+	byName := make(map[string]*zip.File, len(files))
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name, "/")
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if _, ok := byName[name]; !ok {
+			byName[name] = f
+		}
+	}
+	return byName
+}
+
+// Indexes the files that have more than one entry by name, all of them
+// in the order they're in the archive. A packer can put the same file
+// in more than once, compressed different ways, for whichever suits
+// the client.
+func indexVariants(files []*zip.File) map[string][]*zip.File {
+	var variants map[string][]*zip.File
+	byName := make(map[string]*zip.File, len(files))
+	for _, f := range files {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		first, ok := byName[f.Name]
+		if !ok {
+			byName[f.Name] = f
+			continue
+		}
+		if variants == nil {
+			variants = make(map[string][]*zip.File)
+		}
+		if variants[f.Name] == nil {
+			variants[f.Name] = []*zip.File{first}
+		}
+		variants[f.Name] = append(variants[f.Name], f)
+	}
+	return variants
+}
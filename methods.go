@@ -0,0 +1,50 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"compress/bzip2"
+	"compress/flate"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression methods beyond what archive/zip knows about, which newer
+// zip tools can be asked to use.
+const (
+	Bzip2 = 12
+	Zstd  = 93
+)
+
+// Everything that can be read, for entries that archive/zip doesn't
+// read itself.
+var decompressors = map[uint16]zip.Decompressor{
+	zip.Store:    io.NopCloser,
+	zip.Deflate:  flate.NewReader,
+	zipDeflate64: NewDeflate64Reader,
+	Bzip2:        newBzip2Reader,
+	Zstd:         newZstdReader,
+}
+
+func newBzip2Reader(r io.Reader) io.ReadCloser {
+	return io.NopCloser(bzip2.NewReader(r))
+}
+
+func newZstdReader(r io.Reader) io.ReadCloser {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return io.NopCloser(errReader{err})
+	}
+	return zstdReader{d}
+}
+
+type zstdReader struct{ *zstd.Decoder }
+
+func (z zstdReader) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
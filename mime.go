@@ -0,0 +1,116 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+)
+
+// Types for files that are known by their whole name rather than an
+// extension, which would otherwise be sniffed and could well come out
+// as application/octet-stream.
+var NameTypes = map[string]string{
+	"AUTHORS":        "text/plain; charset=utf-8",
+	"CHANGELOG":      "text/plain; charset=utf-8",
+	"CHANGES":        "text/plain; charset=utf-8",
+	"CONTRIBUTORS":   "text/plain; charset=utf-8",
+	"COPYING":        "text/plain; charset=utf-8",
+	"INSTALL":        "text/plain; charset=utf-8",
+	"LICENCE":        "text/plain; charset=utf-8",
+	"LICENSE":        "text/plain; charset=utf-8",
+	"NEWS":           "text/plain; charset=utf-8",
+	"NOTICE":         "text/plain; charset=utf-8",
+	"README":         "text/plain; charset=utf-8",
+	"TODO":           "text/plain; charset=utf-8",
+	"Containerfile":  "text/plain; charset=utf-8",
+	"Dockerfile":     "text/plain; charset=utf-8",
+	"GNUmakefile":    "text/plain; charset=utf-8",
+	"Gemfile":        "text/plain; charset=utf-8",
+	"Jenkinsfile":    "text/plain; charset=utf-8",
+	"Makefile":       "text/plain; charset=utf-8",
+	"Procfile":       "text/plain; charset=utf-8",
+	"Rakefile":       "text/plain; charset=utf-8",
+	"Vagrantfile":    "text/plain; charset=utf-8",
+	"makefile":       "text/plain; charset=utf-8",
+	".editorconfig":  "text/plain; charset=utf-8",
+	".gitattributes": "text/plain; charset=utf-8",
+	".gitignore":     "text/plain; charset=utf-8",
+}
+
+// Works out the entry's Content-Type by its name, or failing that by
+// sniffing the start of it. The answer is remembered for next time.
+func (z *FS) MimeType(f *zip.File) (string, error) {
+	z.rw.RLock()
+	if x, ok := z.mime[f]; ok {
+		z.rw.RUnlock()
+		return x, nil
+	}
+	z.rw.RUnlock()
+	if ctype, ok := TypeByName(f.Name); ok {
+		z.SetMime(f, ctype)
+		return ctype, nil
+	}
+	if Encrypted(f) {
+		// Nothing to sniff without the password
+		return "application/octet-stream", nil
+	}
+	v, err, _ := z.sniffing.Do(f.Name, func() (any, error) {
+		r, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		var chunk [512]byte
+		n, _ := io.ReadFull(r, chunk[:])
+		ctype := detectCharset(http.DetectContentType(chunk[:n]), chunk[:n])
+		z.SetMime(f, ctype)
+		return ctype, nil
+	})
+	return v.(string), err
+}
+
+// The Content-Type for a file by its name alone, if there is one.
+func TypeByName(name string) (string, bool) {
+	ctype, ok := NameTypes[path.Base(name)]
+	if !ok {
+		ctype = mime.TypeByExtension(filepath.Ext(name))
+	}
+	return ctype, ctype != ""
+}
+
+// The entry's type if it's known without reading any of it: worked out
+// already, or going by the name.
+func (z *FS) KnownType(f *zip.File) (string, bool) {
+	z.rw.RLock()
+	ctype, ok := z.mime[f]
+	z.rw.RUnlock()
+	if ok {
+		return ctype, true
+	}
+	return TypeByName(f.Name)
+}
+
+// Whether the type is known without looking at the entry.
+func (z *FS) HasMime(f *zip.File) bool {
+	z.rw.RLock()
+	defer z.rw.RUnlock()
+	_, ok := z.mime[f]
+	return ok
+}
+
+// Decides the entry's Content-Type ahead of MimeType.
+func (z *FS) SetMime(f *zip.File, ctype string) {
+	z.rw.Lock()
+	z.mime[f] = ctype
+	z.rw.Unlock()
+}
+
+// How many entries have their Content-Type worked out.
+func (z *FS) MimeCached() int {
+	z.rw.RLock()
+	defer z.rw.RUnlock()
+	return len(z.mime)
+}
@@ -0,0 +1,288 @@
+package zipfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// The entries found so far in an archive that's still being written,
+// and so has no central directory yet. Each Scan reads the local
+// headers written since the last one. Entries that don't have their
+// sizes in the local header, which is usual for archives written as a
+// stream, are inflated to find where they end, or if they're stored,
+// searched for a data descriptor with the right size in it.
+type Partial struct {
+	mu sync.Mutex
+	// Central directory records for the entries so far
+	dir   bytes.Buffer
+	count int
+	// Where the next local header would start
+	end int64
+}
+
+const (
+	localHeaderLen   = 30
+	localHeaderSig   = 0x04034b50
+	dataDescSig      = 0x08074b50
+	centralHeaderSig = 0x02014b50
+	zip64ExtraID     = 0x0001
+	uint32max        = 0xffffffff
+)
+
+// Reads whatever has been added to r since the last call, and returns
+// an archive of all the complete entries so far, with a central
+// directory made up for them. Offsets into it are the same as in r.
+func (p *Partial) Scan(r io.ReaderAt, size int64) (io.ReaderAt, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size < p.end {
+		// Not the same file any more
+		p.dir.Reset()
+		p.count, p.end = 0, 0
+	}
+	for {
+		next, err := p.scanEntry(r, size)
+		if err != nil {
+			break
+		}
+		p.end = next
+	}
+	tail := p.tail()
+	return &joinedReaderAt{r, p.end, tail}, p.end + int64(len(tail))
+}
+
+var errIncomplete = errors.New("entry not written yet")
+
+// Reads the entry at p.end, adding it to the central directory and
+// returning where the next one starts.
+func (p *Partial) scanEntry(r io.ReaderAt, size int64) (int64, error) {
+	off := p.end
+	var h [localHeaderLen]byte
+	if _, err := r.ReadAt(h[:], off); err != nil {
+		return 0, errIncomplete
+	}
+	le := binary.LittleEndian
+	if le.Uint32(h[0:]) != localHeaderSig {
+		return 0, errIncomplete
+	}
+	flags, method := le.Uint16(h[6:]), le.Uint16(h[8:])
+	crc := le.Uint32(h[14:])
+	compressed, uncompressed := uint64(le.Uint32(h[18:])), uint64(le.Uint32(h[22:]))
+	nameLen, extraLen := int64(le.Uint16(h[26:])), int64(le.Uint16(h[28:]))
+	if flags&0x1 != 0 {
+		return 0, errors.New("encrypted entry")
+	}
+	nameExtra := make([]byte, nameLen+extraLen)
+	if _, err := r.ReadAt(nameExtra, off+localHeaderLen); err != nil {
+		return 0, errIncomplete
+	}
+	name, extra := nameExtra[:nameLen], nameExtra[nameLen:]
+	zip64 := false
+	for e := extra; len(e) >= 4; {
+		id, n := le.Uint16(e), int(le.Uint16(e[2:]))
+		if len(e) < 4+n {
+			break
+		}
+		if id == zip64ExtraID && n >= 16 {
+			zip64 = true
+			uncompressed, compressed = le.Uint64(e[4:]), le.Uint64(e[12:])
+		}
+		e = e[4+n:]
+	}
+	data := off + localHeaderLen + nameLen + extraLen
+	next := data + int64(compressed)
+	if flags&0x8 != 0 {
+		var length int64
+		switch method {
+		case 0:
+			var err error
+			if length, err = findDescriptor(r, data, size); err != nil {
+				return 0, err
+			}
+		case 8:
+			// flate reads a ByteReader one byte at a time, so this
+			// knows exactly where the deflate stream ended
+			cr := &countingByteReader{r: bufio.NewReader(io.NewSectionReader(r, data, size-data))}
+			if _, err := io.Copy(io.Discard, flate.NewReader(cr)); err != nil {
+				return 0, errIncomplete
+			}
+			length = cr.n
+		default:
+			return 0, errors.New("unsized entry that's neither stored nor deflated")
+		}
+		// Sizes are 64 bits if the entry is big enough to need it,
+		// which the local header doesn't always say
+		desc := make([]byte, 24)
+		got, _ := r.ReadAt(desc, data+length)
+		desc = desc[:got]
+		var n int64
+		if len(desc) >= 4 && le.Uint32(desc) == dataDescSig {
+			desc, n = desc[4:], 4
+		}
+		switch {
+		case len(desc) >= 12 && !zip64 && uint64(le.Uint32(desc[4:])) == uint64(length):
+			crc, compressed, uncompressed = le.Uint32(desc), uint64(le.Uint32(desc[4:])), uint64(le.Uint32(desc[8:]))
+			n += 12
+		case len(desc) >= 20 && le.Uint64(desc[4:]) == uint64(length):
+			crc, compressed, uncompressed = le.Uint32(desc), le.Uint64(desc[4:]), le.Uint64(desc[12:])
+			n += 20
+		case len(desc) < 20:
+			return 0, errIncomplete
+		default:
+			return 0, errors.New("data descriptor doesn't match")
+		}
+		next = data + length + n
+	}
+	if next > size {
+		return 0, errIncomplete
+	}
+	p.addCentral(h[:], name, crc, compressed, uncompressed, off)
+	return next, nil
+}
+
+// Adds a central directory record for an entry with the local header h.
+func (p *Partial) addCentral(h, name []byte, crc uint32, compressed, uncompressed uint64, off int64) {
+	le := binary.LittleEndian
+	var zip64 []byte
+	for _, v := range []uint64{uncompressed, compressed, uint64(off)} {
+		if v >= uint32max {
+			zip64 = le.AppendUint64(zip64, v)
+		}
+	}
+	var c [46]byte
+	le.PutUint32(c[0:], centralHeaderSig)
+	le.PutUint16(c[4:], 45)
+	copy(c[6:16], h[4:14]) // version needed, flags, method, time, date
+	le.PutUint32(c[16:], crc)
+	le.PutUint32(c[20:], uint32(min(compressed, uint32max)))
+	le.PutUint32(c[24:], uint32(min(uncompressed, uint32max)))
+	le.PutUint16(c[28:], uint16(len(name)))
+	if zip64 != nil {
+		le.PutUint16(c[30:], uint16(4+len(zip64)))
+	}
+	le.PutUint32(c[42:], uint32(min(uint64(off), uint32max)))
+	p.dir.Write(c[:])
+	p.dir.Write(name)
+	if zip64 != nil {
+		p.dir.Write(le.AppendUint16(le.AppendUint16(nil, zip64ExtraID), uint16(len(zip64))))
+		p.dir.Write(zip64)
+	}
+	p.count++
+}
+
+// The central directory and its end records, to go at p.end.
+func (p *Partial) tail() []byte {
+	le := binary.LittleEndian
+	b := append([]byte(nil), p.dir.Bytes()...)
+	dirSize, dirOff := uint64(p.dir.Len()), uint64(p.end)
+	count := uint64(p.count)
+	if count >= 0xffff || dirSize >= uint32max || dirOff >= uint32max {
+		end64 := uint64(len(b)) + dirOff
+		// Zip64 end of central directory record
+		b = le.AppendUint32(b, 0x06064b50)
+		b = le.AppendUint64(b, 44)
+		b = le.AppendUint16(b, 45)
+		b = le.AppendUint16(b, 45)
+		b = le.AppendUint32(b, 0)
+		b = le.AppendUint32(b, 0)
+		b = le.AppendUint64(b, count)
+		b = le.AppendUint64(b, count)
+		b = le.AppendUint64(b, dirSize)
+		b = le.AppendUint64(b, dirOff)
+		// and its locator
+		b = le.AppendUint32(b, 0x07064b50)
+		b = le.AppendUint32(b, 0)
+		b = le.AppendUint64(b, end64)
+		b = le.AppendUint32(b, 1)
+	}
+	b = le.AppendUint32(b, 0x06054b50)
+	b = le.AppendUint16(b, 0)
+	b = le.AppendUint16(b, 0)
+	b = le.AppendUint16(b, uint16(min(count, 0xffff)))
+	b = le.AppendUint16(b, uint16(min(count, 0xffff)))
+	b = le.AppendUint32(b, uint32(min(dirSize, uint32max)))
+	b = le.AppendUint32(b, uint32(min(dirOff, uint32max)))
+	b = le.AppendUint16(b, 0)
+	return b
+}
+
+// Finds the end of a stored entry starting at data by looking for a
+// data descriptor, with its signature, that has the size so far in it.
+func findDescriptor(r io.ReaderAt, data, size int64) (int64, error) {
+	le := binary.LittleEndian
+	buf := make([]byte, 64<<10)
+	for off := data; off < size; off += int64(len(buf)) - 11 {
+		n, _ := r.ReadAt(buf, off)
+		b := buf[:n]
+		for i := 0; i+12 <= len(b); i++ {
+			if le.Uint32(b[i:]) != dataDescSig {
+				continue
+			}
+			at := off + int64(i) - data
+			// The 64 bit sizes start with the same 32 bits, little endian
+			if uint64(le.Uint32(b[i+8:])) == uint64(at)&uint32max {
+				return at, nil
+			}
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	return 0, errIncomplete
+}
+
+type countingByteReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingByteReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// The first n bytes of r followed by tail.
+type joinedReaderAt struct {
+	r    io.ReaderAt
+	n    int64
+	tail []byte
+}
+
+func (j *joinedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	total := 0
+	if off < j.n {
+		k := int(min(int64(len(p)), j.n-off))
+		n, err := j.r.ReadAt(p[:k], off)
+		total += n
+		if err != nil && !(err == io.EOF && n == k) {
+			return total, err
+		}
+		p, off = p[k:], j.n
+	}
+	if len(p) == 0 {
+		return total, nil
+	}
+	if off-j.n >= int64(len(j.tail)) {
+		return total, io.EOF
+	}
+	n := copy(p, j.tail[off-j.n:])
+	total += n
+	if n < len(p) {
+		return total, io.EOF
+	}
+	return total, nil
+}
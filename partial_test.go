@@ -0,0 +1,192 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type streamEntry struct {
+	name   string
+	method uint16
+	data   []byte
+	// Written with the sizes in the local header rather than a data
+	// descriptor after it
+	raw bool
+}
+
+// An archive as zip.Writer streams it, without its central directory,
+// and where each entry in it ends, descriptor and all.
+func streamed(t *testing.T, entries []streamEntry) ([]byte, []int64) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		if e.raw {
+			fw, err := w.CreateRaw(&zip.FileHeader{
+				Name:               e.name,
+				Method:             zip.Store,
+				CRC32:              crc32.ChecksumIEEE(e.data),
+				CompressedSize64:   uint64(len(e.data)),
+				UncompressedSize64: uint64(len(e.data)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(e.data)
+			continue
+		}
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: e.name, Method: e.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(e.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	eocd := data[len(data)-22:]
+	dirOff := int64(binary.LittleEndian.Uint32(eocd[16:]))
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ends []int64
+	for i, f := range zr.File {
+		off, err := f.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		end := off + int64(f.CompressedSize64)
+		if !entries[i].raw {
+			end += 16
+		}
+		ends = append(ends, end)
+	}
+	if ends[len(ends)-1] != dirOff {
+		t.Fatalf("last entry ends at %d, central directory at %d", ends[len(ends)-1], dirOff)
+	}
+	return data[:dirOff], ends
+}
+
+func partialEntries() []streamEntry {
+	random := make([]byte, 3000)
+	rand.New(rand.NewSource(3)).Read(random)
+	return []streamEntry{
+		{name: "a.txt", method: zip.Deflate, data: []byte(strings.Repeat("deflated ", 500))},
+		{name: "b.bin", method: zip.Store, data: random},
+		{name: "c.txt", raw: true, data: []byte("sizes up front")},
+		{name: "dir/d.txt", method: zip.Deflate, data: []byte("last one")},
+	}
+}
+
+func readAllFile(t *testing.T, z *FS, name string) []byte {
+	t.Helper()
+	got, err := fs.ReadFile(z, name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return got
+}
+
+// Scanning as the archive grows a byte at a time finds each entry as
+// soon as it's complete, and never one that isn't.
+func TestPartialGrowing(t *testing.T) {
+	entries := partialEntries()
+	data, ends := streamed(t, entries)
+	var p Partial
+	for n := int64(0); n <= int64(len(data)); n++ {
+		ra, size := p.Scan(bytes.NewReader(data[:n]), n)
+		z, err := New(ra, size)
+		if err != nil {
+			t.Fatalf("at %d: %v", n, err)
+		}
+		want := 0
+		for _, end := range ends {
+			if end <= n {
+				want++
+			}
+		}
+		if len(z.File) != want {
+			t.Fatalf("at %d: %d entries, want %d", n, len(z.File), want)
+		}
+	}
+	ra, size := p.Scan(bytes.NewReader(data), int64(len(data)))
+	z, err := New(ra, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if got := readAllFile(t, z, e.name); !bytes.Equal(got, e.data) {
+			t.Errorf("%s: got %d bytes, want %d", e.name, len(got), len(e.data))
+		}
+		f := z.Entry(e.name)
+		if f.CRC32 != crc32.ChecksumIEEE(e.data) || f.UncompressedSize64 != uint64(len(e.data)) {
+			t.Errorf("%s: crc %08x size %d", e.name, f.CRC32, f.UncompressedSize64)
+		}
+	}
+}
+
+// A file that got shorter is a different file, scanned from the start.
+func TestPartialTruncated(t *testing.T) {
+	entries := partialEntries()
+	data, _ := streamed(t, entries)
+	var p Partial
+	p.Scan(bytes.NewReader(data), int64(len(data)))
+
+	other, _ := streamed(t, entries[3:])
+	ra, size := p.Scan(bytes.NewReader(other), int64(len(other)))
+	z, err := New(ra, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(z.File) != 1 || z.File[0].Name != "dir/d.txt" {
+		t.Fatalf("got %d entries", len(z.File))
+	}
+	if got := readAllFile(t, z, "dir/d.txt"); string(got) != "last one" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestPartialNotZip(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("PK"), []byte(strings.Repeat("not a zip file ", 10))} {
+		var p Partial
+		ra, size := p.Scan(bytes.NewReader(data), int64(len(data)))
+		z, err := New(ra, size)
+		if err != nil {
+			t.Fatalf("%q: %v", data, err)
+		}
+		if len(z.File) != 0 {
+			t.Errorf("%q: %d entries", data, len(z.File))
+		}
+	}
+}
+
+func TestJoinedReaderAt(t *testing.T) {
+	j := &joinedReaderAt{strings.NewReader("0123456789"), 5, []byte("abc")}
+	for _, tt := range []struct {
+		off  int64
+		n    int
+		want string
+		err  error
+	}{
+		{0, 5, "01234", nil},
+		{3, 4, "34ab", nil},
+		{5, 3, "abc", nil},
+		{6, 4, "bc", io.EOF},
+		{8, 1, "", io.EOF},
+	} {
+		p := make([]byte, tt.n)
+		n, err := j.ReadAt(p, tt.off)
+		if string(p[:n]) != tt.want || err != tt.err {
+			t.Errorf("ReadAt(%d, %d) = %q, %v, want %q, %v", tt.off, tt.n, p[:n], err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package zipfs
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+)
+
+// Opens the entry for reading from anywhere, which http.ServeContent
+// needs for ranges. Stored entries are read straight out of the
+// archive. Deflate has no way into the middle, so anything else is
+// inflated from the start and skipped forward, which at least saves
+// sending it.
+func (z *FS) OpenSeeker(f *zip.File) (io.ReadSeekCloser, error) {
+	if f.Method == zip.Store && f.Flags&0x1 == 0 && f.CompressedSize64 == f.UncompressedSize64 {
+		rs, err := z.RawSeeker(f)
+		if err != nil {
+			return nil, err
+		}
+		return nopCloser{rs}, nil
+	}
+	return &inflateSeeker{open: f.Open, size: int64(f.UncompressedSize64)}, nil
+}
+
+// The entry's data as it's stored in the archive, compressed or not.
+// It's read from whichever archive the entry is in, for Overlay.
+func (z *FS) RawSeeker(f *zip.File) (*io.SectionReader, error) {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	// Which is what archive/zip gives anyway
+	if sr, ok := r.(*io.SectionReader); ok {
+		return sr, nil
+	}
+	off, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(z.raw, off, int64(f.CompressedSize64)), nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+// Seeks by remembering where to be, then gets there on the next Read,
+// starting over if it has to go back.
+type inflateSeeker struct {
+	open func() (io.ReadCloser, error)
+	r    io.ReadCloser
+	pos  int64 // where r is
+	want int64 // where the next Read starts
+	size int64
+}
+
+func (s *inflateSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.want
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("seek: negative position")
+	}
+	s.want = offset
+	return offset, nil
+}
+
+func (s *inflateSeeker) Read(p []byte) (int, error) {
+	if s.r == nil || s.want < s.pos {
+		s.Close()
+		r, err := s.open()
+		if err != nil {
+			return 0, err
+		}
+		s.r, s.pos = r, 0
+	}
+	if s.want > s.pos {
+		n, err := io.CopyN(io.Discard, s.r, s.want-s.pos)
+		s.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	s.want = s.pos
+	return n, err
+}
+
+func (s *inflateSeeker) Close() error {
+	if s.r == nil {
+		return nil
+	}
+	err := s.r.Close()
+	s.r = nil
+	return err
+}
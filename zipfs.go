@@ -0,0 +1,167 @@
+// Package zipfs serves the files in a zip archive over HTTP, sending
+// deflated entries to clients as gzip straight out of the archive
+// rather than inflating them.
+//
+// The zipfs command, in cmd/zipfs, is built on this package and adds
+// everything to do with running a server: several archives at once,
+// swapping them while serving, access rules, caches and so on.
+package zipfs
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// An archive opened for serving. It is an fs.FS through the embedded
+// zip.Reader, and knows a little more than that about its entries:
+// their content types, their raw compressed data, and what's inside
+// each directory.
+type FS struct {
+	*zip.Reader
+	raw   io.ReaderAt
+	files map[string]*zip.File
+	dirs  map[string]*DirInfo
+	mime  map[*zip.File]string
+	rw    sync.RWMutex
+	// Sniffs in progress, so each entry is only read once
+	sniffing singleflight.Group
+	// Files that are in the archive more than once
+	variants map[string][]*zip.File
+}
+
+// Reads the archive in r, which is size bytes long.
+func New(r io.ReaderAt, size int64) (*FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	zr.RegisterDecompressor(zipDeflate64, NewDeflate64Reader)
+	zr.RegisterDecompressor(Bzip2, newBzip2Reader)
+	zr.RegisterDecompressor(Zstd, newZstdReader)
+	return newFS(zr, r), nil
+}
+
+func newFS(zr *zip.Reader, raw io.ReaderAt) *FS {
+	return &FS{
+		Reader:   zr,
+		raw:      raw,
+		files:    indexFiles(zr.File),
+		dirs:     indexDirs(zr.File),
+		variants: indexVariants(zr.File),
+		mime:     make(map[*zip.File]string),
+	}
+}
+
+// Layers the archives into one, with the entries of each shadowing any
+// with the same name in the ones before it. Directories are merged.
+// Entries keep reading from their own archive, which has to stay open
+// as long as the result is used.
+func Overlay(layers ...*FS) *FS {
+	seen := make(map[string]bool)
+	var files []*zip.File
+	for i := len(layers) - 1; i >= 0; i-- {
+		// All of a layer's copies of a name make it through
+		var names []string
+		for _, f := range layers[i].File {
+			name := strings.TrimSuffix(f.Name, "/")
+			if seen[name] {
+				continue
+			}
+			names = append(names, name)
+			files = append(files, f)
+		}
+		for _, name := range names {
+			seen[name] = true
+		}
+	}
+	// A zip.Reader that's only its File list is enough for fs.FS
+	return newFS(&zip.Reader{File: files}, nil)
+}
+
+// Describes the directory name, with "." being the top of the archive.
+// Directories that only exist because there are files in them count
+// too.
+func (z *FS) Dir(name string) (*DirInfo, bool) {
+	d, ok := z.dirs[name]
+	return d, ok
+}
+
+// An open file along with its entry in the archive. Entry is nil for
+// directories that have no entry of their own.
+type ZipEntry struct {
+	fs.File
+	Entry *zip.File
+}
+
+// Opens the named file or directory along with its entry. Files are
+// looked up in the index made when the archive was read; directories
+// are left to the zip.Reader, for ReadDir.
+func (z *FS) Find(name string) (*ZipEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry := z.files[name]
+	if _, ok := z.dirs[name]; ok {
+		d, err := z.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &ZipEntry{d, entry}, nil
+	}
+	if entry == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if Encrypted(entry) {
+		// Found, but unreadable without Decrypt
+		return &ZipEntry{entryFile{io.NopCloser(errReader{ErrPassword}), entry}, entry}, nil
+	}
+	r, err := entry.Open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &ZipEntry{entryFile{r, entry}, entry}, nil
+}
+
+type entryFile struct {
+	io.ReadCloser
+	f *zip.File
+}
+
+func (e entryFile) Stat() (fs.FileInfo, error) { return e.f.FileInfo(), nil }
+
+// Finds the named file and opens its data as it is stored in the
+// archive, without decompressing it. What that is depends on the
+// entry's Method: for zip.Deflate it's a raw deflate stream, which is
+// what goes inside a gzip response.
+func (z *FS) OpenRaw(name string) (*zip.File, io.Reader, error) {
+	entry, err := z.Find(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry.Close()
+	if entry.Entry == nil || entry.Entry.Mode().IsDir() {
+		return nil, nil, &fs.PathError{Op: "openraw", Path: name, Err: errors.New("is a directory")}
+	}
+	r, err := entry.Entry.OpenRaw()
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.Entry, r, nil
+}
+
+// The entry with the given name, if there is one, without opening it.
+func (z *FS) Entry(name string) *zip.File {
+	return z.files[name]
+}
+
+// Every entry with the same name as f, including f, if there's more
+// than one.
+func (z *FS) Variants(f *zip.File) []*zip.File {
+	return z.variants[f.Name]
+}